@@ -0,0 +1,217 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//wildcard host: authenticator for every host which has no own one
+const AnyHost = "*"
+
+//refresh token a little earlier than it really expires
+const tokenExpiryDelta = 10 * time.Second
+
+//Authenticator attach credentials to request
+//implementations must be thread safe, engine use them in many go routes
+type Authenticator interface {
+	//add credentials to request before it is sent
+	Authenticate(request *http.Request) error
+	//server answered 401 for credentials the request was sent with.
+	//return true if credentials were refreshed and request should retry once
+	Refresh(request *http.Request) bool
+}
+
+//http basic auth
+type basicAuthenticator struct {
+	username string
+	password string
+}
+
+func (a *basicAuthenticator) Authenticate(request *http.Request) error {
+	request.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+func (a *basicAuthenticator) Refresh(request *http.Request) bool {
+	return false //static credentials, nothing to refresh
+}
+
+//static bearer token
+type bearerAuthenticator struct {
+	token string
+}
+
+func (a *bearerAuthenticator) Authenticate(request *http.Request) error {
+	request.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+func (a *bearerAuthenticator) Refresh(request *http.Request) bool {
+	return false //static token, nothing to refresh
+}
+
+func CreateBasicAuthenticator(username string, password string) Authenticator {
+	return &basicAuthenticator{username: username, password: password}
+}
+
+func CreateBearerAuthenticator(token string) Authenticator {
+	return &bearerAuthenticator{token: token}
+}
+
+//OAuth2 client credentials grant
+//token is fetched when first needed and fetched again before it expires
+type OAuth2Authenticator struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	scopes       []string
+	client       *http.Client //for token request only
+	token        string       //current access token
+	expiry       time.Time    //zero means never expire
+	lock         sync.Mutex   //guard token and expiry
+}
+
+//token endpoint response
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"` //seconds
+}
+
+func CreateOAuth2Authenticator(tokenUrl string, clientId string, clientSecret string, scopes ...string) *OAuth2Authenticator {
+	return &OAuth2Authenticator{
+		tokenUrl:     tokenUrl,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: Timeout},
+	}
+}
+
+func (a *OAuth2Authenticator) Authenticate(request *http.Request) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.token == "" || (!a.expiry.IsZero() && time.Now().After(a.expiry)) {
+		if e := a.fetchToken(); e != nil {
+			return e
+		}
+	}
+	request.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+//many requests may fail with the same old token, only the first one fetches a new token
+func (a *OAuth2Authenticator) Refresh(request *http.Request) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.token != "" && request.Header.Get("Authorization") != "Bearer "+a.token {
+		return true //token changed since request was signed
+	}
+	if e := a.fetchToken(); e != nil {
+		logger.WarnF("[OAuth2] Refresh Token from: %s Error: %v", a.tokenUrl, e)
+		return false
+	}
+	return true
+}
+
+//request a new token.must hold lock
+func (a *OAuth2Authenticator) fetchToken() error {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(a.scopes) > 0 {
+		form.Set("scope", strings.Join(a.scopes, " "))
+	}
+	request, e := http.NewRequest("POST", a.tokenUrl, strings.NewReader(form.Encode()))
+	if e != nil {
+		return e
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(a.clientId), url.QueryEscape(a.clientSecret))
+	response, e := a.client.Do(request)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		e := response.Body.Close()
+		if e != nil {
+			logger.WarnF("[OAuth2] Token Response Close Error: %v", e)
+		}
+	}()
+	content, e := ioutil.ReadAll(response.Body)
+	if e != nil {
+		return e
+	}
+	if response.StatusCode != 200 {
+		return fmt.Errorf("[OAuth2] Token Url: %s status: %d body: %s", a.tokenUrl, response.StatusCode, string(content))
+	}
+	token := &oauth2Token{}
+	if e := json.Unmarshal(content, token); e != nil {
+		return fmt.Errorf("[OAuth2] Token Response Parse Error: %v", e)
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("[OAuth2] Token Url: %s returns empty access_token", a.tokenUrl)
+	}
+	a.token = token.AccessToken
+	if token.ExpiresIn > 0 {
+		a.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryDelta)
+	} else {
+		a.expiry = time.Time{}
+	}
+	logger.DebugF("[OAuth2] Got Token from: %s expires in %d seconds", a.tokenUrl, token.ExpiresIn)
+	return nil
+}
+
+//use authenticator for host. host is "name" or "name:port", AnyHost for all hosts
+//nil authenticator remove the host's one
+func (engine *HttpEngine) SetAuthenticator(host string, authenticator Authenticator) {
+	engine.authLock.Lock()
+	defer engine.authLock.Unlock()
+	if authenticator == nil {
+		delete(engine.authenticators, host)
+		return
+	}
+	if engine.authenticators == nil {
+		engine.authenticators = make(map[string]Authenticator)
+	}
+	engine.authenticators[host] = authenticator
+}
+
+//find authenticator: "host:port" first, then "host", then AnyHost
+func (engine *HttpEngine) authenticatorOf(u *url.URL) Authenticator {
+	engine.authLock.RLock()
+	defer engine.authLock.RUnlock()
+	if len(engine.authenticators) == 0 {
+		return nil
+	}
+	if a, ok := engine.authenticators[u.Host]; ok {
+		return a
+	}
+	if a, ok := engine.authenticators[u.Hostname()]; ok {
+		return a
+	}
+	return engine.authenticators[AnyHost]
+}
+
+//attach credentials if host has authenticator
+func (engine *HttpEngine) applyAuth(request *http.Request) error {
+	authenticator := engine.authenticatorOf(request.URL)
+	if authenticator == nil {
+		return nil
+	}
+	return authenticator.Authenticate(request)
+}
+
+//server answered 401. true means credentials refreshed and worth one more try
+func (engine *HttpEngine) refreshAuth(request *http.Request) bool {
+	authenticator := engine.authenticatorOf(request.URL)
+	if authenticator == nil {
+		return false
+	}
+	return authenticator.Refresh(request)
+}
@@ -0,0 +1,118 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHttpEngine_BasicAndBearerAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+
+	httpEngine := CreateEngine()
+	httpEngine.SetAuthenticator(serverUrl.Host, CreateBasicAuthenticator("user", "pass"))
+	html, e := httpEngine.Get(server.URL, nil)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != "Basic dXNlcjpwYXNz" {
+		t.Errorf("wrong basic auth header: %s", html)
+	}
+	httpEngine.SetAuthenticator(serverUrl.Host, nil)
+	httpEngine.SetAuthenticator(AnyHost, CreateBearerAuthenticator("static"))
+	html, e = httpEngine.Get(server.URL, nil)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != "Bearer static" {
+		t.Errorf("wrong bearer auth header: %s", html)
+	}
+}
+
+func TestHttpEngine_OAuth2Auth(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&tokenRequests, 1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+	defer tokenServer.Close()
+	//first token is revoked by api server, only accept the refreshed one
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer apiServer.Close()
+	apiUrl, _ := url.Parse(apiServer.URL)
+
+	httpEngine := CreateEngine()
+	httpEngine.SetAuthenticator(apiUrl.Hostname(), CreateOAuth2Authenticator(tokenServer.URL, "client", "secret", "read"))
+	html, e := httpEngine.Get(apiServer.URL, nil)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != "ok" {
+		t.Errorf("wrong response: %s", html)
+	}
+	//token is cached now
+	if _, e := httpEngine.Get(apiServer.URL, nil); e != nil {
+		t.Fatalf("%v", e)
+	}
+	if n := atomic.LoadInt32(&tokenRequests); n != 2 {
+		t.Errorf("expected 2 token requests, got %d", n)
+	}
+}
+
+func TestHttpEngine_OAuth2ConcurrentRefresh(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokenRequests, 1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600}`, n)
+	}))
+	defer tokenServer.Close()
+	//all requests fail with the first token at the same time
+	var unauthorized sync.WaitGroup
+	unauthorized.Add(10)
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			unauthorized.Done()
+			unauthorized.Wait()
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer apiServer.Close()
+
+	httpEngine := CreateEngine()
+	httpEngine.SetAuthenticator(AnyHost, CreateOAuth2Authenticator(tokenServer.URL, "client", "secret"))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, e := httpEngine.Get(apiServer.URL, nil); e != nil {
+				t.Errorf("%v", e)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&tokenRequests); n != 2 {
+		t.Errorf("one refresh for all failed requests, got %d token requests", n)
+	}
+}
@@ -0,0 +1,249 @@
+package network
+
+import (
+	"cake/util"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//circuit breaker states
+const (
+	BreakerClosed   = iota //requests pass
+	BreakerOpen            //requests fail fast
+	BreakerHalfOpen        //some probe requests pass
+)
+
+var breakerStateNames = []string{"closed", "open", "half-open"}
+
+//BreakerConfig decides when a host breaker opens and closes. zero fields use DefaultBreakerConfig
+type BreakerConfig struct {
+	FailureRatio   float64       //open when failures / results in window reach it
+	MinRequests    int           //ratio is judged only when window has this many results
+	WindowSize     int           //how many recent results are judged
+	CoolDown       time.Duration //how long open state lasts before half-open
+	HalfOpenProbes int           //successful probes needed to close again
+}
+
+//open at 50% failures of last 20 requests, probe again after 30 seconds
+func DefaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		FailureRatio:   0.5,
+		MinRequests:    10,
+		WindowSize:     20,
+		CoolDown:       util.GetTimeSecond(30),
+		HalfOpenProbes: 1,
+	}
+}
+
+//copy of config, zero fields filled from DefaultBreakerConfig.
+//error if a breaker with it could never open or never close
+func breakerConfigOf(config *BreakerConfig) (*BreakerConfig, error) {
+	valid := *config
+	defaults := DefaultBreakerConfig()
+	if valid.FailureRatio == 0 {
+		valid.FailureRatio = defaults.FailureRatio
+	}
+	if valid.WindowSize == 0 {
+		valid.WindowSize = defaults.WindowSize
+	}
+	if valid.MinRequests == 0 {
+		valid.MinRequests = defaults.MinRequests
+		if valid.MinRequests > valid.WindowSize {
+			valid.MinRequests = valid.WindowSize
+		}
+	}
+	if valid.CoolDown == 0 {
+		valid.CoolDown = defaults.CoolDown
+	}
+	if valid.HalfOpenProbes == 0 {
+		valid.HalfOpenProbes = defaults.HalfOpenProbes
+	}
+	switch {
+	case valid.FailureRatio < 0 || valid.FailureRatio > 1:
+		return nil, fmt.Errorf("[Breaker] FailureRatio: %v must be in (0, 1]", valid.FailureRatio)
+	case valid.WindowSize < 0 || valid.MinRequests < 0 || valid.CoolDown < 0 || valid.HalfOpenProbes < 0:
+		return nil, fmt.Errorf("[Breaker] Negative config: %+v", valid)
+	case valid.MinRequests > valid.WindowSize:
+		return nil, fmt.Errorf("[Breaker] MinRequests: %d more than WindowSize: %d, breaker never opens", valid.MinRequests, valid.WindowSize)
+	}
+	return &valid, nil
+}
+
+//error returned when request is rejected by an open breaker
+type BreakerOpenError struct {
+	Host string
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of host: %s is open. fail fast", e.Host)
+}
+
+//state of one host
+type hostBreaker struct {
+	state        int
+	results      []bool //ring buffer. true is failure
+	next         int    //next index to write in results
+	count        int    //results in window
+	failures     int    //failures in window
+	openedAt     time.Time
+	probing      int //probe requests in flight
+	probeSuccess int //successful probes in half-open
+}
+
+func (b *hostBreaker) reset() {
+	for i := range b.results {
+		b.results[i] = false
+	}
+	b.next, b.count, b.failures = 0, 0, 0
+	b.probing, b.probeSuccess = 0, 0
+}
+
+func (b *hostBreaker) add(failure bool) {
+	if b.count == len(b.results) {
+		if b.results[b.next] {
+			b.failures -= 1
+		}
+	} else {
+		b.count += 1
+	}
+	b.results[b.next] = failure
+	if failure {
+		b.failures += 1
+	}
+	b.next = (b.next + 1) % len(b.results)
+}
+
+//all breakers of one engine
+type circuitBreakers struct {
+	config   *BreakerConfig
+	hosts    map[string]*hostBreaker
+	lock     sync.Mutex
+	opened   int64 //times any breaker opened
+	rejected int64 //requests failed fast
+}
+
+func createCircuitBreakers(config *BreakerConfig) *circuitBreakers {
+	return &circuitBreakers{
+		config: config,
+		hosts:  make(map[string]*hostBreaker),
+	}
+}
+
+//must hold lock
+func (c *circuitBreakers) hostOf(host string) *hostBreaker {
+	b, ok := c.hosts[host]
+	if !ok {
+		b = &hostBreaker{results: make([]bool, c.config.WindowSize)}
+		c.hosts[host] = b
+	}
+	return b
+}
+
+//must hold lock
+func (c *circuitBreakers) changeState(host string, b *hostBreaker, state int) {
+	logger.WarnF("[Breaker] Host: %s %s -> %s", host, breakerStateNames[b.state], breakerStateNames[state])
+	if state == BreakerOpen {
+		b.openedAt = time.Now()
+		atomic.AddInt64(&c.opened, 1)
+	}
+	b.state = state
+	b.reset()
+}
+
+//check before every request.nil means request can be sent and record() must follow
+func (c *circuitBreakers) allow(host string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	b := c.hostOf(host)
+	if b.state == BreakerOpen {
+		if time.Since(b.openedAt) < c.config.CoolDown {
+			atomic.AddInt64(&c.rejected, 1)
+			return &BreakerOpenError{Host: host}
+		}
+		c.changeState(host, b, BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probing+b.probeSuccess >= c.config.HalfOpenProbes {
+			atomic.AddInt64(&c.rejected, 1)
+			return &BreakerOpenError{Host: host}
+		}
+		b.probing += 1
+	}
+	return nil
+}
+
+//record result of request which was allowed
+func (c *circuitBreakers) record(host string, failure bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	b := c.hostOf(host)
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing -= 1
+		if failure {
+			c.changeState(host, b, BreakerOpen)
+			return
+		}
+		b.probeSuccess += 1
+		if b.probeSuccess >= c.config.HalfOpenProbes {
+			c.changeState(host, b, BreakerClosed)
+		}
+	case BreakerClosed:
+		b.add(failure)
+		if b.count >= c.config.MinRequests &&
+			float64(b.failures)/float64(b.count) >= c.config.FailureRatio {
+			c.changeState(host, b, BreakerOpen)
+		}
+	default:
+		//result of request sent before breaker opened. ignore
+	}
+}
+
+//state name of every known host
+func (c *circuitBreakers) states() map[string]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	states := make(map[string]string, len(c.hosts))
+	for host, b := range c.hosts {
+		states[host] = breakerStateNames[b.state]
+	}
+	return states
+}
+
+//enable per host circuit breaker, nil config to disable
+//zero fields of config use DefaultBreakerConfig, config is copied.
+//error when FailureRatio is out of (0, 1], a field is negative or MinRequests > WindowSize.
+//call it before engine is used
+func (engine *HttpEngine) SetCircuitBreaker(config *BreakerConfig) error {
+	if config == nil {
+		engine.breakers = nil
+		return nil
+	}
+	valid, e := breakerConfigOf(config)
+	if e != nil {
+		return e
+	}
+	engine.breakers = createCircuitBreakers(valid)
+	return nil
+}
+
+func (engine *HttpEngine) breakerAllow(host string) error {
+	if engine.breakers == nil {
+		return nil
+	}
+	return engine.breakers.allow(host)
+}
+
+func (engine *HttpEngine) breakerRecord(host string, failure bool) {
+	if engine.breakers == nil {
+		return
+	}
+	engine.breakers.record(host, failure)
+}
+
+//5xx and network errors mean host is in trouble,other status means host is alive
+func isHostFailure(statusCode int) bool {
+	return statusCode >= 500
+}
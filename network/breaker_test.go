@@ -0,0 +1,124 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_States(t *testing.T) {
+	breakers := createCircuitBreakers(&BreakerConfig{
+		FailureRatio:   0.5,
+		MinRequests:    4,
+		WindowSize:     4,
+		CoolDown:       50 * time.Millisecond,
+		HalfOpenProbes: 1,
+	})
+	host := "down.com"
+	for i := 0; i < 4; i++ {
+		if e := breakers.allow(host); e != nil {
+			t.Fatalf("closed breaker rejected: %v", e)
+		}
+		breakers.record(host, i%2 == 0)
+	}
+	if e := breakers.allow(host); e == nil {
+		t.Fatalf("breaker should be open")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if e := breakers.allow(host); e != nil {
+		t.Fatalf("breaker should allow a probe: %v", e)
+	}
+	if e := breakers.allow(host); e == nil {
+		t.Fatalf("only one probe allowed in half-open")
+	}
+	if state := breakers.states()[host]; state != "half-open" {
+		t.Errorf("expected half-open got %s", state)
+	}
+	breakers.record(host, false)
+	if state := breakers.states()[host]; state != "closed" {
+		t.Errorf("expected closed got %s", state)
+	}
+}
+
+func TestBreakerConfig(t *testing.T) {
+	defaults := DefaultBreakerConfig()
+	config, e := breakerConfigOf(&BreakerConfig{})
+	if e != nil || *config != *defaults {
+		t.Errorf("empty config should be default: %+v %v", config, e)
+	}
+	config, e = breakerConfigOf(&BreakerConfig{WindowSize: 4})
+	if e != nil || config.MinRequests != 4 || config.HalfOpenProbes != 1 || config.FailureRatio != 0.5 {
+		t.Errorf("missing fields should be filled: %+v %v", config, e)
+	}
+	bad := []*BreakerConfig{
+		{FailureRatio: 1.5},
+		{FailureRatio: -0.5},
+		{MinRequests: 30, WindowSize: 20},
+		{HalfOpenProbes: -1},
+		{CoolDown: -time.Second},
+	}
+	for _, config := range bad {
+		if _, e := breakerConfigOf(config); e == nil {
+			t.Errorf("config should be rejected: %+v", config)
+		}
+	}
+	if e := CreateEngine().SetCircuitBreaker(&BreakerConfig{MinRequests: 30, WindowSize: 20}); e == nil {
+		t.Errorf("SetCircuitBreaker should reject bad config")
+	}
+}
+
+//config without probes closes again after cool down
+func TestCircuitBreaker_DefaultProbes(t *testing.T) {
+	config, e := breakerConfigOf(&BreakerConfig{MinRequests: 2, WindowSize: 2, CoolDown: 10 * time.Millisecond})
+	if e != nil {
+		t.Fatal(e)
+	}
+	breakers := createCircuitBreakers(config)
+	host := "ok.com"
+	for i := 0; i < 2; i++ {
+		_ = breakers.allow(host)
+		breakers.record(host, false)
+	}
+	if state := breakers.states()[host]; state != "closed" {
+		t.Errorf("all requests succeeded, breaker should stay closed: %s", state)
+	}
+	for i := 0; i < 2; i++ {
+		_ = breakers.allow(host)
+		breakers.record(host, true)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if e := breakers.allow(host); e != nil {
+		t.Fatalf("breaker should allow a probe: %v", e)
+	}
+	breakers.record(host, false)
+	if state := breakers.states()[host]; state != "closed" {
+		t.Errorf("expected closed got %s", state)
+	}
+}
+
+func TestHttpEngine_CircuitBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	httpEngine := CreateEngineByParams(MaxConnections, Timeout, 1)
+	config := DefaultBreakerConfig()
+	config.MinRequests = 3
+	if e := httpEngine.SetCircuitBreaker(config); e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 3; i++ {
+		if _, e := httpEngine.Get(server.URL, nil); e == nil {
+			t.Fatalf("503 should fail")
+		}
+	}
+	_, e := httpEngine.Get(server.URL, nil)
+	if _, ok := e.(*BreakerOpenError); !ok {
+		t.Fatalf("expected BreakerOpenError got %v", e)
+	}
+	metrics := httpEngine.Metrics()
+	if metrics.BreakerOpened != 1 || metrics.BreakerRejected != 1 {
+		t.Errorf("wrong metrics: %+v", metrics)
+	}
+}
@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+//query params only used for tracking, "*" at end matches a prefix
+var DefaultTrackingParams = []string{"utm_*", "gclid", "fbclid", "msclkid", "yclid", "mc_cid", "mc_eid", "_ga"}
+
+//Canonicalizer rewrites urls so variants of the same page are deduplicated
+type Canonicalizer struct {
+	StripFragment      bool     //"/a#top" -> "/a"
+	SortQuery          bool     //"?b=1&a=2" -> "?a=2&b=1"
+	DropParams         []string //query params removed, like DefaultTrackingParams
+	LowercaseHost      bool     //"WWW.Example.com" -> "www.example.com"
+	RemoveDefaultPort  bool     //"http://a.com:80" -> "http://a.com"
+	StripTrailingSlash bool     //"/a/" -> "/a", root path "/" is kept
+}
+
+//everything on except StripTrailingSlash, some sites treat "/a/" and "/a" differently
+func DefaultCanonicalizer() *Canonicalizer {
+	return &Canonicalizer{
+		StripFragment:     true,
+		SortQuery:         true,
+		DropParams:        DefaultTrackingParams,
+		LowercaseHost:     true,
+		RemoveDefaultPort: true,
+	}
+}
+
+//canonical form of an absolute url
+func (c *Canonicalizer) Canonicalize(raw string) (string, error) {
+	u, e := url.Parse(strings.TrimSpace(raw))
+	if e != nil {
+		return "", e
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("url: %s is not absolute", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if c.LowercaseHost {
+		u.Host = strings.ToLower(u.Host)
+	}
+	if c.RemoveDefaultPort {
+		port := u.Port()
+		if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+			u.Host = strings.TrimSuffix(u.Host, ":"+port)
+		}
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if c.StripTrailingSlash && len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		u.RawPath = ""
+	}
+	if c.StripFragment {
+		u.Fragment, u.RawFragment = "", ""
+	}
+	u.RawQuery = c.query(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+//drop and sort params of raw query, encoding of params is kept
+func (c *Canonicalizer) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		if !c.dropParam(paramName(param)) {
+			params = append(params, param)
+		}
+	}
+	if c.SortQuery {
+		//same name keeps its order
+		sort.SliceStable(params, func(i, j int) bool { return paramName(params[i]) < paramName(params[j]) })
+	}
+	return strings.Join(params, "&")
+}
+
+func paramName(param string) string {
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		return param[:i]
+	}
+	return param
+}
+
+func (c *Canonicalizer) dropParam(name string) bool {
+	if unescaped, e := url.QueryUnescape(name); e == nil {
+		name = unescaped
+	}
+	name = strings.ToLower(name)
+	for _, drop := range c.DropParams {
+		drop = strings.ToLower(drop)
+		if strings.HasSuffix(drop, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(drop, "*")) {
+				return true
+			}
+		} else if name == drop {
+			return true
+		}
+	}
+	return false
+}
+
+//resolve link against base, the final url of page it was found in, then canonicalize it
+//base is nil for seeds
+func (c *Crawler) normalize(link *Link, base *url.URL) error {
+	raw := strings.TrimSpace(link.Url)
+	if base != nil {
+		ref, e := url.Parse(raw)
+		if e != nil {
+			return e
+		}
+		raw = base.ResolveReference(ref).String()
+	}
+	if c.Canonicalizer != nil {
+		canonical, e := c.Canonicalizer.Canonicalize(raw)
+		if e != nil {
+			return e
+		}
+		raw = canonical
+	}
+	link.Url = raw
+	return nil
+}
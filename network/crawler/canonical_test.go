@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"bytes"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalizer_Canonicalize(t *testing.T) {
+	c := DefaultCanonicalizer()
+	cases := map[string]string{
+		"HTTP://WWW.Example.COM":                         "http://www.example.com/",
+		"http://www.example.com:80/a#top":                "http://www.example.com/a",
+		"https://www.example.com:443/a/":                 "https://www.example.com/a/",
+		"https://www.example.com:8443/a":                 "https://www.example.com:8443/a",
+		"http://a.com/s?b=2&a=1&b=1":                     "http://a.com/s?a=1&b=2&b=1",
+		"http://a.com/s?utm_source=x&id=3&gclid=y&UTM_X": "http://a.com/s?id=3",
+		"http://a.com/s?q=a%20b&p":                       "http://a.com/s?p&q=a%20b",
+		"http://a.com/s?":                                "http://a.com/s",
+	}
+	for raw, expected := range cases {
+		canonical, e := c.Canonicalize(raw)
+		if e != nil {
+			t.Errorf("url: %s Error: %v", raw, e)
+		} else if canonical != expected {
+			t.Errorf("url: %s expected: %s got: %s", raw, expected, canonical)
+		}
+	}
+	c.StripTrailingSlash = true
+	if canonical, _ := c.Canonicalize("http://a.com/dir/"); canonical != "http://a.com/dir" {
+		t.Errorf("trailing slash not stripped: %s", canonical)
+	}
+	if canonical, _ := c.Canonicalize("http://a.com/"); canonical != "http://a.com/" {
+		t.Errorf("root should keep slash: %s", canonical)
+	}
+	for _, raw := range []string{"/relative", "mailto:a@b.com", "http://a.com/%zz"} {
+		if _, e := c.Canonicalize(raw); e == nil {
+			t.Errorf("url: %s should fail", raw)
+		}
+	}
+}
+
+//processor returns hrefs as they are written in page
+type relativeProcessor struct {
+	*testSite
+}
+
+func (p *relativeProcessor) Process(link *Link, html string) []*Link {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(html)))
+	if err != nil {
+		return nil
+	}
+	p.lock.Lock()
+	p.visited = append(p.visited, link.Url)
+	p.lock.Unlock()
+	var links []*Link
+	doc.Find("a").Each(func(i int, selection *goquery.Selection) {
+		if href, exists := selection.Attr("href"); exists {
+			links = append(links, &Link{Url: href})
+		}
+	})
+	return links
+}
+
+func TestCrawler_RelativeLinks(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/dir/index": {"page", "page#comments", "./page?utm_source=feed", "../top", "mailto:a@b.com"},
+		"/dir/page":  {"/top?b=2&a=1", "/top?a=1&b=2"},
+		"/top":       nil,
+	})
+	defer site.server.Close()
+	handler := site.server.Config.Handler
+	site.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/dir/index", http.StatusFound)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	processor := &relativeProcessor{site}
+	c := CreateCrawler(processor, site, site.server.URL+"/start")
+	c.WaitTime = time.Nanosecond
+	c.Start()
+	if c.CurrentFetchedPages != 4 || c.CurrentFailPages != 0 {
+		t.Errorf("expected 4 fetched 0 fail, got %d %d", c.CurrentFetchedPages, c.CurrentFailPages)
+	}
+	sort.Strings(site.visited)
+	visited := strings.ReplaceAll(strings.Join(site.visited, " "), site.server.URL, "")
+	if visited != "/dir/page /start /top /top?a=1&b=2" {
+		t.Errorf("wrong pages: %s", visited)
+	}
+}
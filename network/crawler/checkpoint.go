@@ -0,0 +1,381 @@
+package crawler
+
+import (
+	"bufio"
+	"cake/util"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	frontierFileName = "frontier.log" //pushed and done links, in the log format of FileFrontier
+	seenFileName     = "seen.log"     //urls and request keys passed duplicate check, one per line
+)
+
+//save checkpoint every 30 seconds by default
+var DefaultCheckpointInterval = util.GetTimeSecond(30)
+
+//crawl progress saved in a directory: pending links and seen urls
+type checkpoint struct {
+	dir        string
+	interval   time.Duration
+	resumed    []*frontierEntry //pending links of last run, pushed to frontier on Start
+	nextId     uint64
+	seen       map[string]struct{}
+	seenFile   *os.File
+	seenWriter *bufio.Writer
+	lock       sync.Mutex
+}
+
+//save crawl progress into dir every interval, so a crashed crawl can go on.
+//if dir already has a checkpoint, crawler resumes from it instead of seeds.
+//it works with any frontier: pushed and done links are logged in dir while the frontier
+//keeps the links, so SetFrontier can be called before or after it.
+//must be called before Start. interval <= 0 uses DefaultCheckpointInterval
+func (c *Crawler) EnableCheckpoint(dir string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	if e := os.MkdirAll(dir, os.ModePerm); e != nil {
+		return fmt.Errorf("[Checkpoint] Create Dir: %s Error: %v", dir, e)
+	}
+	//replay log of last run, pending links go to frontier on Start
+	last := &FileFrontier{path: filepath.Join(dir, frontierFileName)}
+	if e := last.load(); e != nil {
+		return e
+	}
+	cp := &checkpoint{
+		dir:      dir,
+		interval: interval,
+		resumed:  last.queue,
+		nextId:   last.nextId,
+		seen:     make(map[string]struct{}),
+	}
+	if e := cp.loadSeen(); e != nil {
+		return e
+	}
+	//links still pending were popped before crash, they must be fetched again
+	for _, entry := range cp.resumed {
+		delete(cp.seen, entry.link.key())
+	}
+	var e error
+	cp.seenFile, e = os.OpenFile(filepath.Join(dir, seenFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		return fmt.Errorf("[Checkpoint] Open seen file Error: %v", e)
+	}
+	cp.seenWriter = bufio.NewWriter(cp.seenFile)
+	c.checkpoint = cp
+	if len(cp.resumed) > 0 {
+		logger.InfoF("[Checkpoint] Resume from: %s -> %d pending links, %d seen urls", dir, len(cp.resumed), len(cp.seen))
+	}
+	return nil
+}
+
+//push pending links of checkpoint to frontier, its links are logged from now on
+func (c *Crawler) resume() error {
+	if c.checkpoint == nil {
+		return nil
+	}
+	frontier, e := c.checkpoint.wrap(c.frontier)
+	if e != nil {
+		return fmt.Errorf("[Checkpoint] Resume Error: %v", e)
+	}
+	c.frontier = frontier
+	return nil
+}
+
+//log pushed and done links of frontier, pending links of last run are pushed to it first
+func (cp *checkpoint) wrap(frontier Frontier) (Frontier, error) {
+	f := &journalFrontier{
+		Frontier: frontier,
+		path:     filepath.Join(cp.dir, frontierFileName),
+		pending:  make(map[string][]uint64),
+		nextId:   cp.nextId,
+	}
+	for _, entry := range cp.resumed {
+		if e := frontier.Push(entry.link); e != nil {
+			return nil, e
+		}
+		f.pending[entry.link.key()] = append(f.pending[entry.link.key()], entry.id)
+	}
+	//rewrite log without finished links
+	if e := f.compact(cp.resumed); e != nil {
+		return nil, e
+	}
+	cp.resumed = nil
+	return f, nil
+}
+
+func (cp *checkpoint) loadSeen() error {
+	file, e := os.Open(filepath.Join(cp.dir, seenFileName))
+	if os.IsNotExist(e) {
+		return nil
+	}
+	if e != nil {
+		return fmt.Errorf("[Checkpoint] Open seen file Error: %v", e)
+	}
+	defer func() {
+		e := file.Close()
+		if e != nil {
+			logger.WarnF("[Checkpoint] Close seen file Error: %v", e)
+		}
+	}()
+	reader := bufio.NewReader(file)
+	for {
+		line, e := reader.ReadString('\n')
+		if e == io.EOF {
+			break //not finished line is ignored too
+		}
+		if e != nil {
+			return fmt.Errorf("[Checkpoint] Read seen file Error: %v", e)
+		}
+		if url := strings.TrimSuffix(line, "\n"); url != "" {
+			cp.seen[url] = struct{}{}
+		}
+	}
+	return nil
+}
+
+//true if url was seen before crash, otherwise record it
+func (cp *checkpoint) checkSeen(url string) bool {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	if _, ok := cp.seen[url]; ok {
+		return true
+	}
+	cp.seen[url] = struct{}{}
+	if _, e := cp.seenWriter.WriteString(url + "\n"); e != nil {
+		logger.WarnF("[Checkpoint] Write seen url: %s Error: %v", url, e)
+	}
+	return false
+}
+
+//flush seen urls and frontier to disk
+func (cp *checkpoint) save(frontier Frontier) error {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	if e := cp.seenWriter.Flush(); e != nil {
+		return e
+	}
+	if e := cp.seenFile.Sync(); e != nil {
+		return e
+	}
+	if persistent, ok := frontier.(PersistentFrontier); ok {
+		return persistent.Checkpoint()
+	}
+	return nil
+}
+
+func (cp *checkpoint) close(frontier Frontier) {
+	if e := cp.save(frontier); e != nil {
+		logger.ErrorF("[Checkpoint] Save Error: %v", e)
+	}
+	if e := cp.seenFile.Close(); e != nil {
+		logger.WarnF("[Checkpoint] Close seen file Error: %v", e)
+	}
+}
+
+//journalFrontier logs links pushed to and done in the frontier it wraps,
+//in the log format of FileFrontier. links themselves stay in the wrapped frontier,
+//so a spilling or priority frontier keeps working with checkpoint
+type journalFrontier struct {
+	Frontier
+	path      string
+	file      *os.File
+	writer    *bufio.Writer
+	pending   map[string][]uint64 //link key -> ids of its pending log entries in push order
+	nextId    uint64
+	doneCount int //done since last compact
+	lock      sync.Mutex
+}
+
+func (f *journalFrontier) savesLinks() {}
+
+func (f *journalFrontier) Push(link *Link) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	entry := &frontierEntry{id: f.nextId, link: link}
+	if e := writeEntry(f.writer, entry); e != nil {
+		return e
+	}
+	f.nextId += 1
+	if e := f.Frontier.Push(link); e != nil {
+		if _, e := f.writer.WriteString("-" + strconv.FormatUint(entry.id, 10) + "\n"); e != nil {
+			logger.WarnF("[Checkpoint] Write done link: %s Error: %v", link.Url, e)
+		}
+		return e
+	}
+	key := link.key()
+	f.pending[key] = append(f.pending[key], entry.id)
+	return nil
+}
+
+//links of a key are alike, the first pending entry is finished
+func (f *journalFrontier) Done(link *Link) error {
+	if e := f.Frontier.Done(link); e != nil {
+		return e
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := link.key()
+	ids := f.pending[key]
+	if len(ids) == 0 {
+		return fmt.Errorf("[Checkpoint] Link: %s was not pushed", link.Url)
+	}
+	if len(ids) == 1 {
+		delete(f.pending, key)
+	} else {
+		f.pending[key] = ids[1:]
+	}
+	if _, e := f.writer.WriteString("-" + strconv.FormatUint(ids[0], 10) + "\n"); e != nil {
+		return e
+	}
+	f.doneCount += 1
+	if f.doneCount >= frontierCompactSize {
+		return f.compact(nil)
+	}
+	return nil
+}
+
+//metrics of wrapped frontier, nil if it has none
+func (f *journalFrontier) Metrics() *FrontierMetrics {
+	if metrics, ok := f.Frontier.(interface{ Metrics() *FrontierMetrics }); ok {
+		return metrics.Metrics()
+	}
+	return nil
+}
+
+//flush log to disk
+func (f *journalFrontier) Checkpoint() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if e := f.writer.Flush(); e != nil {
+		return e
+	}
+	if e := f.file.Sync(); e != nil {
+		return e
+	}
+	if persistent, ok := f.Frontier.(PersistentFrontier); ok {
+		return persistent.Checkpoint()
+	}
+	return nil
+}
+
+//close log and wrapped frontier
+func (f *journalFrontier) Close() error {
+	f.lock.Lock()
+	var e error
+	if f.file != nil {
+		e = f.writer.Flush()
+		if closeError := f.file.Close(); e == nil {
+			e = closeError
+		}
+		f.file, f.writer = nil, nil
+	}
+	f.lock.Unlock()
+	if closeError := f.Frontier.Close(); e == nil {
+		e = closeError
+	}
+	return e
+}
+
+//rewrite log with pending entries only. entries are written as given,
+//otherwise pending entries are copied from old log, links are not kept in memory. must hold lock
+func (f *journalFrontier) compact(entries []*frontierEntry) error {
+	tmpPath := f.path + ".tmp"
+	file, e := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if e != nil {
+		return fmt.Errorf("[Checkpoint] Create: %s Error: %v", tmpPath, e)
+	}
+	writer := bufio.NewWriter(file)
+	if entries != nil || f.file == nil {
+		for _, entry := range entries {
+			e = writeEntry(writer, entry)
+			if e != nil {
+				break
+			}
+		}
+	} else {
+		e = f.copyPending(writer)
+	}
+	if e == nil {
+		e = writer.Flush()
+	}
+	if e == nil {
+		e = file.Sync()
+	}
+	if e != nil {
+		_ = file.Close()
+		return e
+	}
+	if e := file.Close(); e != nil {
+		return e
+	}
+	if f.file != nil {
+		if e := f.file.Close(); e != nil {
+			logger.WarnF("[Checkpoint] Close: %s Error: %v", f.path, e)
+		}
+		f.file, f.writer = nil, nil
+	}
+	if e := os.Rename(tmpPath, f.path); e != nil {
+		return fmt.Errorf("[Checkpoint] Rename: %s Error: %v", tmpPath, e)
+	}
+	f.file, e = os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		return fmt.Errorf("[Checkpoint] Open: %s Error: %v", f.path, e)
+	}
+	f.writer = bufio.NewWriter(f.file)
+	f.doneCount = 0
+	return nil
+}
+
+//copy push lines of pending entries from log to writer. must hold lock
+func (f *journalFrontier) copyPending(writer *bufio.Writer) error {
+	if e := f.writer.Flush(); e != nil {
+		return e
+	}
+	pending := make(map[uint64]bool)
+	for _, ids := range f.pending {
+		for _, id := range ids {
+			pending[id] = true
+		}
+	}
+	file, e := os.Open(f.path)
+	if e != nil {
+		return fmt.Errorf("[Checkpoint] Open: %s Error: %v", f.path, e)
+	}
+	defer func() {
+		e := file.Close()
+		if e != nil {
+			logger.WarnF("[Checkpoint] Close: %s Error: %v", f.path, e)
+		}
+	}()
+	reader := bufio.NewReader(file)
+	for {
+		line, e := reader.ReadString('\n')
+		if e == io.EOF {
+			return nil
+		}
+		if e != nil {
+			return fmt.Errorf("[Checkpoint] Read: %s Error: %v", f.path, e)
+		}
+		if !strings.HasPrefix(line, "+") {
+			continue
+		}
+		space := strings.IndexByte(line, ' ')
+		if space < 0 {
+			continue
+		}
+		if id, e := strconv.ParseUint(line[1:space], 10, 64); e == nil && pending[id] {
+			if _, e := writer.WriteString(line); e != nil {
+				return e
+			}
+		}
+	}
+}
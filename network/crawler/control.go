@@ -0,0 +1,115 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+//CrawlHandle is returned by StartAsync to control and wait a running crawler
+type CrawlHandle struct {
+	crawler *Crawler
+}
+
+var errNotRunning = errors.New("crawler is not running. Use AddSeeds before Start")
+
+//queue links while crawling, safe to call from any go route, like a hook or a feed reader.
+//links are queued like seeds: depth 0 and duplicates are skipped when popped.
+//an idle crawler waits IdleGrace for them before it finishes.
+//error if crawler is not started yet or is stopping
+func (c *Crawler) Enqueue(links ...*Link) error {
+	c.stopLock.Lock()
+	defer c.stopLock.Unlock()
+	if !c.accepting || c.isShutdown() {
+		return errNotRunning
+	}
+	for _, link := range links {
+		atomic.AddInt64(&c.pending, 1)
+		if !c.pushSeed(link) {
+			atomic.AddInt64(&c.pending, -1)
+		}
+	}
+	c.wake()
+	return nil
+}
+
+//start crawler in a new go route and return at once
+func (c *Crawler) StartAsync() (*CrawlHandle, error) {
+	e := crawlerValid(c)
+	if e != nil {
+		return nil, e
+	}
+	if !atomic.CompareAndSwapInt32(&c.started, 0, 1) {
+		return nil, errAlreadyStarted
+	}
+	if e := c.resume(); e != nil {
+		return nil, e
+	}
+	go c.run()
+	return &CrawlHandle{crawler: c}, nil
+}
+
+//blocking until crawler finished
+func (h *CrawlHandle) Wait() {
+	<-h.crawler.done
+}
+
+//closed when crawler finished
+func (h *CrawlHandle) Done() <-chan struct{} {
+	return h.crawler.done
+}
+
+func (h *CrawlHandle) Crawler() *Crawler {
+	return h.crawler
+}
+
+//stop crawler and wait for in-flight fetches.
+//DrainOnStop: links already queued are fetched, links found after Stop are dropped.
+//otherwise: no more fetch, links queued or found are left in frontier for checkpoint.
+//return ctx error if ctx is done before crawler finished
+func (c *Crawler) Stop(ctx context.Context) error {
+	atomic.StoreInt32(&c.paused, 0)
+	c.stopWith(StopReasonStopped)
+	c.wake()
+	if atomic.LoadInt32(&c.started) == 0 {
+		return nil //never started. nothing to wait
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//stop fetching new links, in-flight fetches go on
+func (c *Crawler) Pause() {
+	if atomic.CompareAndSwapInt32(&c.paused, 0, 1) {
+		logger.Info("Crawler Paused.")
+		c.wake()
+	}
+}
+
+//go on fetching after Pause
+func (c *Crawler) Resume() {
+	if atomic.CompareAndSwapInt32(&c.paused, 1, 0) {
+		logger.Info("Crawler Resumed.")
+		c.wake()
+	}
+}
+
+func (c *Crawler) IsPaused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
+
+func (c *Crawler) isShutdown() bool {
+	return atomic.LoadInt32(&c.shutdown) == 1
+}
+
+//notify fetch loop, never block
+func (c *Crawler) wake() {
+	select {
+	case c.wakeChannel <- struct{}{}:
+	default: //already has a notice
+	}
+}
@@ -0,0 +1,128 @@
+package crawler
+
+import (
+	"cake/util/datastruct"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//every page /n links to /n+1 ... /n+3, crawl never ends by itself
+func createInfiniteSite(served *int64) *testSite {
+	site := &testSite{urlPool: datastruct.CreateHashSet("infinite-site")}
+	site.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(served, 1)
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		html := "<html><body>"
+		for i := 1; i <= 3; i++ {
+			html += fmt.Sprintf("<a href=\"/%d\">next</a>", n+i)
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(html + "</body></html>"))
+	}))
+	return site
+}
+
+func TestCrawler_StartAsyncAndStop(t *testing.T) {
+	var served int64
+	site := createInfiniteSite(&served)
+	defer site.server.Close()
+	c := CreateCrawlerByMaxThreads(5, site, site, site.server.URL+"/0")
+	c.WaitTime = 0
+	handle, e := c.StartAsync()
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if _, e := c.StartAsync(); e == nil {
+		t.Errorf("crawler can not start twice")
+	}
+	time.Sleep(200 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if e := c.Stop(ctx); e != nil {
+		t.Fatalf("stop failed: %v", e)
+	}
+	select {
+	case <-handle.Done():
+	default:
+		t.Errorf("handle should be done after Stop")
+	}
+	stopped := atomic.LoadInt64(&served)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt64(&served) != stopped {
+		t.Errorf("requests sent after Stop")
+	}
+}
+
+func TestCrawler_PauseAndResume(t *testing.T) {
+	var served int64
+	site := createInfiniteSite(&served)
+	defer site.server.Close()
+	c := CreateCrawlerByMaxThreads(5, site, site, site.server.URL+"/0")
+	c.WaitTime = 0
+	handle, e := c.StartAsync()
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.Pause()
+	if !c.IsPaused() {
+		t.Fatalf("crawler should be paused")
+	}
+	time.Sleep(200 * time.Millisecond) //in-flight fetches finish
+	paused := atomic.LoadInt64(&served)
+	time.Sleep(200 * time.Millisecond)
+	if atomic.LoadInt64(&served) != paused {
+		t.Errorf("requests sent while paused")
+	}
+	c.Resume()
+	time.Sleep(200 * time.Millisecond)
+	if atomic.LoadInt64(&served) == paused {
+		t.Errorf("no requests after resume")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if e := c.Stop(ctx); e != nil {
+		t.Fatalf("stop failed: %v", e)
+	}
+	handle.Wait()
+}
+
+func TestCrawler_EnqueueWhileIdle(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": nil, "/late": {"/late-a"}, "/late-a": nil})
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = NoWait
+	c.IdleGrace = 2 * time.Second
+	if e := c.Enqueue(&Link{Url: site.server.URL + "/late"}); e == nil {
+		t.Errorf("Enqueue before Start should fail")
+	}
+	var idles int32
+	c.Hooks.OnIdle = func() {
+		if atomic.AddInt32(&idles, 1) == 1 { //a feed brings a link when crawl is idle
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				if e := c.Enqueue(&Link{Url: site.server.URL + "/late"}); e != nil {
+					t.Errorf("%v", e)
+				}
+			}()
+		}
+	}
+	start := time.Now()
+	c.Start()
+	if c.CurrentFetchedPages != 3 || c.StopReason() != StopReasonFinished {
+		t.Errorf("enqueued link and its links should be fetched: %d %s", c.CurrentFetchedPages, c.StopReason())
+	}
+	if cost := time.Since(start); cost < 2*time.Second || cost > 4*time.Second {
+		t.Errorf("crawl should finish one grace after the late link, cost: %v", cost)
+	}
+	if e := c.Enqueue(&Link{Url: site.server.URL + "/"}); e == nil {
+		t.Errorf("Enqueue after finish should fail")
+	}
+}
@@ -4,19 +4,37 @@ import (
 	"cake/network"
 	"cake/util"
 	"cake/util/log"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	UrlChannelSize = 100
+	DefaultWorkers = 20 //fetch go routes of a crawler
 )
 
 const (
 	StatusSuccess = 1
 	StatusFail = 2
+	StatusBlocked = 3 //disallowed by robots.txt
+	StatusRetry = 4 //failed and queued again
+)
+
+//how crawler choose User-Agent from UserAgentList
+const (
+	UserAgentFixed = iota //UseUserAgent(0), unless engine has a header profile or rotator
+	UserAgentRandom //random agent per request
+	UserAgentRoundRobin //agents one by one
+	UserAgentSticky //same agent for same host
 )
 
 var UserAgentList = []string{
@@ -38,7 +56,10 @@ var UserAgentList = []string{
 
 var logger = log.GetLogger()
 
+var errAlreadyStarted = fmt.Errorf("crawler already started. A crawler can only start once")
+
 //interface of processor: for business obj process result and provide links
+//implement ItemProcessor to send extracted items to Pipeline
 type Processor interface {
 	//process result and return links
 	Process(link *Link,html string) []*Link
@@ -54,21 +75,127 @@ type URLFilter interface {
 type Link struct {
 	Url string
 	AttrMap map[string]string
+	Meta Meta //typed values, AttrMap is kept for strings
+	Parent string //url of page link was found in, "" for seeds
+	DiscoveredAt time.Time //when link was found or seeded
+	Depth int //start link is 0, links found in it are 1 ...
+	Priority int //higher is fetched first by PriorityFrontier
+	Attempts int //failed attempts, crawler retries link until MaxRetries
+	Method string //GET when empty
+	Headers map[string]string //set over crawler headers, like User-Agent
+	Body []byte //request body, like form of a POST
+	Referer string //page link was found in, crawler sets it when empty
+	Cookies map[string]string //replace Cookie header of request
+	Timeout time.Duration //0 is timeout of http engine
+	Idempotent bool //POST or PATCH is safe to send again, otherwise failed ones are not retried
+}
+
+//copy of link, its maps and body are not shared
+func (l *Link) clone() *Link {
+	clone := *l
+	clone.AttrMap = copyStrings(l.AttrMap)
+	clone.Meta = l.Meta.Clone()
+	clone.Headers = copyStrings(l.Headers)
+	clone.Cookies = copyStrings(l.Cookies)
+	if l.Body != nil {
+		clone.Body = append([]byte(nil),l.Body...)
+	}
+	return &clone
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string,len(m))
+	for k,v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+//key of duplicate check: url of a GET, method, url and body hash of other requests
+//so POST pages of one url are not duplicates
+func (l *Link) key() string {
+	method := strings.ToUpper(l.Method)
+	if (method == "" || method == http.MethodGet) && len(l.Body) == 0 {
+		return l.Url
+	}
+	sum := sha1.Sum(l.Body)
+	return method+" "+l.Url+" "+hex.EncodeToString(sum[:])
+}
+
+func (l *Link) request(headers map[string]string) *network.Request {
+	return &network.Request{
+		Method: l.Method,
+		Url: l.Url,
+		Headers: headers,
+		Body: l.Body,
+		Cookies: l.Cookies,
+		Timeout: l.Timeout,
+		Idempotent: l.Idempotent,
+	}
+}
+
+//result of one link sent back to fetch loop
+type fetchResult struct {
+	link   *Link
+	status int
+	bytes  int //body size of fetched page
 }
 
 //crawler controller: schedule go route to fetch web page
 type Crawler struct {
-	startLink           string              //where to start
+	seeds               []*Link             //where to start
 	processor           Processor           //business processor
 	urlFilter           URLFilter           //business impl url filter
+	seenRequests        map[string]bool     //keys of links with method or body, URLFilter has urls only. fetch loop only
 	httpClient          *network.HttpEngine //for fetch url pages
-	shutdown            bool                //for stop crawler or finished close
-	urlChannel          chan *Link          //url queue to fetch
-	resultChannel       chan int            //status of result
+	shutdown            int32               //1 when stopping or finished. atomic
+	started             int32               //1 when started. atomic
+	paused              int32               //1 when paused. atomic
+	wakeChannel         chan struct{}       //wake fetch loop when paused,resumed or stopped
+	done                chan struct{}       //closed when crawler finished
+	workChannel         chan *Link          //links sent to workers
+	resultChannel       chan *fetchResult   //status of result
+	frontier            Frontier            //links waiting to fetch
+	checkpoint          *checkpoint         //save progress, nil is disabled
 	WaitTime            time.Duration       //fetch Interval time
-	CurrentFetchedPages int                 //current fetched pages statistics
-	CurrentFailPages    int                 //current fail pages statistics
-	wg                  *sync.WaitGroup     //wait for shutdown
+	CurrentFetchedPages int                 //Deprecated: not safe while crawling, use Stats
+	CurrentFailPages    int                 //Deprecated: not safe while crawling, use Stats
+	CurrentBlockedPages int                 //Deprecated: not safe while crawling, use Stats
+	wg                  *sync.WaitGroup     //wait for workers exit
+	Workers             int                 //fetch go routes, set before Start
+	userAgentStrategy   int                 //how to choose User-Agent
+	pending             int64               //links queued or fetching. crawl ends when it is 0
+	inFlight            int                 //fetching links. only used in fetch loop
+	IdleGrace           time.Duration       //wait for links from Enqueue when crawl is idle. 0 finish at once
+	DrainOnStop         bool                //when stop: true fetch links already queued, false leave them in frontier
+	draining            int32               //1 when stopping by Stop with DrainOnStop. atomic
+	stopReason          string              //why crawler stopped
+	stopLock            sync.Mutex          //guard stopReason
+	MaxDepth            int                 //links deeper than it are not enqueued. 0 is unlimited
+	MaxPages            int                 //stop when fetched so many pages. 0 is unlimited
+	MaxFailures         int                 //stop when so many pages failed. 0 is unlimited
+	MaxDuration         time.Duration       //stop when crawl runs so long. 0 is unlimited
+	robots              *robotsCache        //robots.txt per host, nil is disabled
+	politeness          *politeness         //delay between requests of a host
+	HostDelay           time.Duration       //min delay between requests of a host. 0 is none
+	PriorityFunc        func(*Link) int     //set Priority of seeds and found links, nil keeps Link.Priority
+	Canonicalizer       *Canonicalizer      //rewrite urls before deduplication, nil keeps urls as they are
+	scope               *Scope              //hosts and paths to crawl, nil is everywhere
+	accepting           bool                //Enqueue can push links, guarded by stopLock
+	outOfScopeLinks     int64               //found links dropped by scope. atomic
+	droppedLinks        int64               //links could not be queued. atomic
+	pipeline            *Pipeline           //items of ItemProcessor go through it, nil discards items
+	MaxRetries          int                 //retry a link failed with FailureRetry so many times, see DefaultRetryDelay
+	ClassifyFailure     func(*Link,error) int //kind of failure, nil uses FailureKind
+	deadLetters         *deadLetters        //links given up
+	stats               *crawlStats         //progress counters, read by Stats
+	ProgressInterval    time.Duration       //log progress so often. 0 is never
+	Hooks               Hooks               //event callbacks, set before Start
+	retries             *retryQueue         //failed links waiting for RetryDelay
+	RetryDelay          time.Duration       //delay before first retry, doubled for every next one
 }
 
 func randomUserAgent() string {
@@ -79,12 +206,46 @@ func UseUserAgent(index int) string {
 	return UserAgentList[index]
 }
 
+//choose User-Agent strategy, default is UserAgentFixed
+//with EnableRobots pages are sent as the robots agent and the strategy is not used
+func (c *Crawler) SetUserAgentStrategy(strategy int) error {
+	var rotator network.UserAgentRotator
+	var e error
+	switch strategy {
+	case UserAgentFixed:
+	case UserAgentRandom:
+		rotator, e = network.CreateRandomRotator(UserAgentList)
+	case UserAgentRoundRobin:
+		rotator, e = network.CreateRoundRobinRotator(UserAgentList)
+	case UserAgentSticky:
+		rotator, e = network.CreateStickyRotator(UserAgentList)
+	default:
+		return fmt.Errorf("unknown user agent strategy: %d",strategy)
+	}
+	if e != nil {
+		return e
+	}
+	c.httpClient.SetUserAgentRotator(rotator)
+	c.userAgentStrategy = strategy
+	return nil
+}
+
+//engine used by crawler. configure default headers or profiles on it
+func (c *Crawler) HttpEngine() *network.HttpEngine {
+	return c.httpClient
+}
+
 func crawlerValid(c *Crawler) error {
 	if c == nil {
 		return fmt.Errorf("crawler is nil. Nothing to Do")
 	}
-	if c.startLink == "" {
-		return fmt.Errorf("startLink must be specified. Nothing to Do")
+	if len(c.seeds) == 0 {
+		return fmt.Errorf("at least one seed must be specified. Nothing to Do")
+	}
+	for _,seed := range c.seeds {
+		if seed == nil || seed.Url == "" {
+			return fmt.Errorf("seed url must be specified. Nothing to Do")
+		}
 	}
 	if c.processor == nil {
 		return fmt.Errorf("processor is nil. Nothing to Do")
@@ -95,39 +256,82 @@ func crawlerValid(c *Crawler) error {
 	if c.httpClient == nil {
 		return fmt.Errorf("httpClient is nil. Nothing to Do")
 	}
+	if c.Workers <= 0 {
+		return fmt.Errorf("workers must be positive. Nothing to Do")
+	}
 	return nil
 }
 
+//options for CreateCrawlerByOptions, zero value uses default
+//CrawlerOptions.WaitTime for no wait between fetches, 0 is the default wait
+const NoWait time.Duration = -1
+
+type CrawlerOptions struct {
+	MaxConnections int           //concurrent http connections, 0 uses network.MaxConnections
+	Workers        int           //fetch go routes, 0 uses DefaultWorkers
+	WaitTime       time.Duration //fetch Interval time of every worker, 0 uses 500ms, NoWait for none
+}
+
 func CreateCrawler(processor Processor,filter URLFilter,startLink string) *Crawler {
-	return &Crawler{
-		startLink:     startLink,
-		processor:     processor,
-		urlFilter:     filter,
-		httpClient:    network.CreateEngine(),
-		shutdown:      false,
-		urlChannel:    make(chan *Link,UrlChannelSize),
-		resultChannel: make(chan int,UrlChannelSize),
-		WaitTime:      util.GetTimeMilliSecond(500),
-		wg:            &sync.WaitGroup{},
-	}
+	return CreateCrawlerByOptions(processor,filter,startLink,nil)
 }
 
 func CreateCrawlerByMaxThreads(maxThreads int,processor Processor,filter URLFilter,startLink string) *Crawler {
+	return CreateCrawlerByOptions(processor,filter,startLink,&CrawlerOptions{
+		MaxConnections: maxThreads,
+		Workers:        maxThreads,
+	})
+}
+
+func CreateCrawlerByOptions(processor Processor,filter URLFilter,startLink string,options *CrawlerOptions) *Crawler {
+	return CreateCrawlerWithSeeds(processor,filter,[]*Link{{Url: startLink}},options)
+}
+
+//crawl from many seeds with their AttrMap. options can be nil
+func CreateCrawlerWithSeeds(processor Processor,filter URLFilter,seeds []*Link,options *CrawlerOptions) *Crawler {
+	if options == nil {
+		options = &CrawlerOptions{}
+	}
+	maxConnections := options.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = network.MaxConnections
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	waitTime := options.WaitTime
+	if waitTime == 0 {
+		waitTime = util.GetTimeMilliSecond(500)
+	} else if waitTime < 0 {
+		waitTime = 0
+	}
 	return &Crawler{
-		startLink:     startLink,
+		seeds:         seeds,
 		processor:     processor,
 		urlFilter:     filter,
-		httpClient:    network.CreateEngineByParams(maxThreads,network.Timeout,network.Retries),
-		shutdown:      false,
-		urlChannel:    make(chan *Link,UrlChannelSize),
-		resultChannel: make(chan int,UrlChannelSize),
-		WaitTime:      util.GetTimeMilliSecond(500),
+		seenRequests:  make(map[string]bool),
+		httpClient:    network.CreateEngineByParams(maxConnections,network.Timeout,network.Retries),
+		workChannel:   make(chan *Link),
+		resultChannel: make(chan *fetchResult,workers),
+		frontier:      CreateSpillingFrontier(DefaultSpillThreshold,""),
+		wakeChannel:   make(chan struct{},1),
+		done:          make(chan struct{}),
+		WaitTime:      waitTime,
+		Workers:       workers,
 		wg:            &sync.WaitGroup{},
+		politeness:    createPoliteness(),
+		Canonicalizer: DefaultCanonicalizer(),
+		MaxRetries:    DefaultMaxRetries,
+		deadLetters:   &deadLetters{},
+		retries:       &retryQueue{},
+		stats:         createCrawlStats(),
+		RetryDelay:    DefaultRetryDelay,
 	}
 }
 
 //main method to start fetch web pages
-//blocking util finish
+//blocking util finish: no link queued and no fetch pending, or Stop was called
 //fetch concurrent inner
 func (c *Crawler) Start() {
 	e := crawlerValid(c)
@@ -135,59 +339,405 @@ func (c *Crawler) Start() {
 		logger.ErrorF("%v",e)
 		return
 	}
+	if !atomic.CompareAndSwapInt32(&c.started,0,1) {
+		logger.ErrorF("%v",errAlreadyStarted)
+		return
+	}
+	if e := c.resume(); e != nil {
+		logger.ErrorF("%v",e)
+		return
+	}
+	c.run()
+}
+
+//add more seeds, must be called before Start. use Enqueue while crawling
+func (c *Crawler) AddSeeds(seeds ...*Link) {
+	c.seeds = append(c.seeds,seeds...)
+}
+
+//replace default SpillingFrontier, must be called before Start
+//use PriorityFrontier to fetch links by Link.Priority. checkpoint logs links of any frontier
+func (c *Crawler) SetFrontier(frontier Frontier) {
+	c.frontier = frontier
+}
+
+//backpressure of frontier, nil if frontier has no metrics
+func (c *Crawler) FrontierMetrics() *FrontierMetrics {
+	if f, ok := c.frontier.(interface{ Metrics() *FrontierMetrics }); ok {
+		return f.Metrics()
+	}
+	return nil
+}
+
+func (c *Crawler) run() {
+	defer close(c.done)
 	//statistic time cost
 	defer util.FuncElapsed("Crawler Start")()
 
-	//add first url
-	c.urlChannel <- &Link{
-		Url:     c.startLink,
-		AttrMap: nil,
+	//frontier may have links from checkpoint, otherwise begin with seeds
+	if c.frontier.Len() == 0 {
+		for _,s := range c.seeds {
+			c.pushSeed(s)
+		}
+	}
+	c.stopLock.Lock()
+	atomic.StoreInt64(&c.pending,int64(c.frontier.Len()))
+	c.accepting = true //Enqueue counts its links from now on
+	c.stopLock.Unlock()
+	c.politeness.setup(c.HostDelay,c.robots != nil)
+	if c.robots != nil {
+		c.robots.setup(c.RetryDelay)
+		if c.userAgentStrategy != UserAgentFixed || c.httpClient.HasUserAgent() {
+			logger.WarnF("[Robots] Pages are sent as: %s. User-Agent strategy and header profile are not used",c.robots.userAgent)
+		}
+	}
+	c.stats.begin()
+	var progressTick <-chan time.Time
+	if c.ProgressInterval > 0 {
+		ticker := time.NewTicker(c.ProgressInterval)
+		defer ticker.Stop()
+		progressTick = ticker.C
+	}
+	var checkpointTick <-chan time.Time
+	if c.checkpoint != nil {
+		ticker := time.NewTicker(c.checkpoint.interval)
+		defer ticker.Stop()
+		checkpointTick = ticker.C
+	}
+	var idle <-chan time.Time //grace timer when nothing pending
+	var deadline <-chan time.Time //nil channel is never selected
+	if c.MaxDuration > 0 {
+		timer := time.NewTimer(c.MaxDuration)
+		defer timer.Stop()
+		deadline = timer.C
 	}
+	//fixed workers pull links from fetch loop
+	for i := 0; i < c.Workers; i++ {
+		c.wg.Add(1)
+		go c.worker()
+	}
+	var next *Link //popped link waiting for a free worker
 	//fetch loop
-	for !c.shutdown {
-		select {
-		case link,ok := <- c.urlChannel:
-			if !ok {
-				c.shutdown = true
-				continue
+	for {
+		if next == nil {
+			next = c.readyLink()
+		}
+		if c.isShutdown() && !c.isDraining() && c.inFlight == 0 {
+			break //stop and abandon: links left in frontier
+		}
+		if c.unfinished() == 0 {
+			if c.IdleGrace <= 0 || c.isShutdown() {
+				c.onIdle()
+				if c.finishIdle() {
+					break
+				}
+				continue //links were enqueued meanwhile
 			}
-			if !c.urlFilter.CheckDuplicate(link.Url) {
-				c.wg.Add(1)
-				go c.fetch(link) //concurrent fetch
-			} else {
-				logger.TraceF("url: %s duplicate. Skip!",link.Url)
+			if idle == nil {
+				c.onIdle()
+				logger.InfoF("Crawler idle. Wait %v for late links",c.IdleGrace)
+				idle = time.After(c.IdleGrace)
+			}
+		}
+		var workChannel chan *Link //nil channel is never selected
+		if next != nil && c.canDispatch() {
+			workChannel = c.workChannel
+		}
+		var retryTimer *time.Timer
+		var retryTick <-chan time.Time
+		if wait, ok := c.retries.wait(); ok && !c.isShutdown() {
+			retryTimer = time.NewTimer(wait)
+			retryTick = retryTimer.C
+		}
+		var politeTimer *time.Timer
+		var politeTick <-chan time.Time
+		if next == nil {
+			if wait, ok := c.politeness.wait(); ok {
+				politeTimer = time.NewTimer(wait)
+				politeTick = politeTimer.C
 			}
-		case status := <- c.resultChannel:
-			if status == StatusSuccess {
+		}
+		select {
+		case workChannel <- next:
+			c.politeness.reserve(next)
+			idle = nil
+			c.inFlight += 1
+			c.stats.dispatched()
+			next = nil
+		case result := <- c.resultChannel:
+			idle = nil
+			c.inFlight -= 1
+			c.stats.record(result)
+			switch result.status {
+			case StatusSuccess:
 				c.CurrentFetchedPages += 1
-			} else {
+			case StatusBlocked:
+				c.CurrentBlockedPages += 1
+			case StatusFail:
 				c.CurrentFailPages += 1
 			}
-		case <- time.After(util.GetTimeSecond(15)): //timeout for select: we determine this for shutdown
-			close(c.urlChannel)
+			if result.status == StatusRetry {
+				atomic.AddInt64(&c.pending,-1) //done in frontier when its retry is pushed
+			} else {
+				c.finish(result.link)
+			}
+			c.checkLimits()
+		case <- progressTick:
+			c.logProgress()
+		case <- checkpointTick:
+			if e := c.checkpoint.save(c.frontier); e != nil {
+				logger.ErrorF("[Checkpoint] Save Error: %v",e)
+			}
+		case <- c.wakeChannel: //paused, resumed or stopped. check again
+		case <- idle: //nothing came in grace time
+			if !c.finishIdle() {
+				idle = nil
+			}
+		case <- deadline:
+			c.stopWith(StopReasonMaxDuration)
+		case <- retryTick:
+			c.requeueRetries(false)
+		case <- politeTick: //a host is ready again
+		}
+		if retryTimer != nil {
+			retryTimer.Stop()
 		}
+		if politeTimer != nil {
+			politeTimer.Stop()
+		}
+	}
+	close(c.workChannel)
+	c.wg.Wait() //wait for all workers exit
+	c.requeueRetries(true) //left in frontier for checkpoint
+	if c.checkpoint != nil {
+		c.checkpoint.close(c.frontier)
 	}
-	c.wg.Wait() //wait for all go route done
-	logger.Info("Crawler Shutdown.")
+	if e := c.frontier.Close(); e != nil {
+		logger.WarnF("Close frontier Error: %v",e)
+	}
+	if c.pipeline != nil {
+		if e := c.pipeline.Close(); e != nil {
+			logger.WarnF("Close pipeline Error: %v",e)
+		}
+	}
+	if c.ProgressInterval > 0 {
+		c.logProgress()
+	}
+	logger.InfoF("Crawler Shutdown. Reason: %s",c.StopReason())
+	c.stats.finish()
+	c.onFinish()
 }
 
+//not paused, not stopping without drain and pages budget left
+func (c *Crawler) canDispatch() bool {
+	return !c.IsPaused() && !(c.isShutdown() && !c.isDraining()) && c.pageBudgetLeft()
+}
 
-func (c *Crawler) fetch(link *Link) {
+//queue a copy of seed at depth 0, false if it is dropped. seeds given by caller are not changed
+func (c *Crawler) pushSeed(s *Link) bool {
+	seed := s.clone()
+	seed.Depth = 0
+	if seed.DiscoveredAt.IsZero() {
+		seed.DiscoveredAt = time.Now()
+	}
+	if e := c.normalize(seed,nil); e != nil {
+		logger.ErrorF("Bad seed: %s Error: %v",seed.Url,e)
+		return false
+	}
+	if e := c.checkMeta(seed); e != nil {
+		c.dropLink(seed,e)
+		return false
+	}
+	c.prioritize(seed)
+	if e := c.frontier.Push(seed); e != nil {
+		c.dropLink(seed,e)
+		return false
+	}
+	return true
+}
+
+//pop next link not duplicate, nil if nothing can be fetched now
+//stopping without drain: links are left in frontier
+func (c *Crawler) nextLink() *Link {
+	for c.canDispatch() {
+		link, e := c.frontier.Pop()
+		if e != nil {
+			logger.ErrorF("Pop link Error: %v",e)
+			return nil
+		}
+		if link == nil {
+			return nil
+		}
+		if link.Attempts > 0 || !c.isDuplicate(link) { //retried link was seen before
+			return link
+		}
+		logger.TraceF("url: %s duplicate. Skip!",link.Url)
+		c.stats.duplicate()
+		c.onDuplicate(link)
+		c.finish(link)
+	}
+	return nil
+}
+
+//resolve links found in parent against base, set depth and drop bad, out of scope or too deep ones
+//copies are queued, links and slice given by processor are not changed
+func (c *Crawler) childLinks(parent *Link,base *url.URL,links []*Link) []*Link {
+	children := make([]*Link,0,len(links))
+	for _,found := range links {
+		if found == nil {
+			continue
+		}
+		link := found.clone()
+		if e := c.normalize(link,base); e != nil {
+			logger.TraceF("url: %s found in: %s Error: %v. Skip!",link.Url,parent.Url,e)
+			continue
+		}
+		if c.outOfScope(link) {
+			logger.TraceF("url: %s out of scope. Skip!",link.Url)
+			continue
+		}
+		if e := c.checkMeta(link); e != nil { //processor set meta frontier can't save
+			c.dropLink(link,e)
+			continue
+		}
+		link.Depth = parent.Depth + 1
+		link.Parent = parent.Url
+		if link.DiscoveredAt.IsZero() {
+			link.DiscoveredAt = time.Now()
+		}
+		if c.tooDeep(link) {
+			logger.TraceF("url: %s depth: %d deeper than %d. Skip!",link.Url,link.Depth,c.MaxDepth)
+			continue
+		}
+		if link.Referer == "" && !(base.Scheme == "https" && strings.HasPrefix(link.Url,"http:")) {
+			link.Referer = base.String() //no https page sent to http, like browsers
+		}
+		c.prioritize(link)
+		c.onLinkDiscovered(parent,link)
+		children = append(children,link)
+	}
+	return children
+}
+
+//fetch links one by one until work channel closed
+func (c *Crawler) worker() {
 	defer c.wg.Done()
+	for link := range c.workChannel {
+		c.fetch(link)
+	}
+}
+
+//seen in checkpoint or business filter says duplicate
+//URLFilter only gets urls, requests with method or body are checked by crawler
+func (c *Crawler) isDuplicate(link *Link) bool {
+	key := link.key()
+	if c.checkpoint != nil && c.checkpoint.checkSeen(key) {
+		return true
+	}
+	if key == link.Url {
+		return c.urlFilter.CheckDuplicate(link.Url)
+	}
+	if c.seenRequests[key] {
+		return true
+	}
+	c.seenRequests[key] = true
+	return false
+}
+
+//popped link will never come back
+func (c *Crawler) finish(link *Link) {
+	if e := c.frontier.Done(link); e != nil {
+		logger.WarnF("Frontier Done link: %s Error: %v",link.Url,e)
+	}
+	atomic.AddInt64(&c.pending,-1)
+}
+
+
+//headers of every request crawler sends
+func (c *Crawler) requestHeaders() map[string]string {
 	headerMap := make(map[string]string)
-	headerMap["UserAgent"] = UseUserAgent(0)
-	html, e := c.httpClient.Get(link.Url, headerMap)
+	if c.robots != nil { //obey robots.txt as the agent we send
+		headerMap["User-Agent"] = c.robots.userAgent
+	} else if c.userAgentStrategy == UserAgentFixed && !c.httpClient.HasUserAgent() {
+		//a header profile or rotator of engine wins over the fixed agent
+		headerMap["User-Agent"] = UseUserAgent(0)
+	}
+	return headerMap
+}
+
+//headers of link request: crawler headers, Referer and headers of link
+func (c *Crawler) linkHeaders(link *Link) map[string]string {
+	headerMap := c.requestHeaders()
+	if link.Referer != "" {
+		headerMap["Referer"] = link.Referer
+	}
+	for k, v := range link.Headers {
+		headerMap[http.CanonicalHeaderKey(k)] = v //"user-agent" replaces User-Agent
+	}
+	return headerMap
+}
+
+func (c *Crawler) fetch(link *Link) {
+	headerMap := c.linkHeaders(link)
+	if target, e := url.Parse(link.Url); e == nil {
+		allowed, crawlDelay, e := c.robotsAllowed(target,headerMap["User-Agent"])
+		if c.robots != nil && c.politeness.learned(target.Host,crawlDelay) {
+			c.wake() //fetch loop held links of host until Crawl-delay is known
+		}
+		if e != nil { //not blocked, robots.txt is fetched again before retry
+			c.fail(link,RetryLaterError(e))
+			return
+		}
+		if !allowed {
+			logger.InfoF("url: %s disallowed by robots.txt. Skip!",link.Url)
+			c.resultChannel <- &fetchResult{link: link, status: StatusBlocked}
+			return
+		}
+	}
+	c.onRequest(link)
+	request := link.request(headerMap)
+	response, e := c.httpClient.Do(request)
+	var statusError *network.StatusError
+	if errors.As(e,&statusError) && statusError.Response != nil {
+		c.onResponse(link,statusError.Response) //for audit and metrics of every status
+	}
 	if e != nil {
-		logger.ErrorF("%v",e)
-		c.resultChannel <- StatusFail
+		if !request.Retryable() { //a form may be submitted already
+			c.fail(link,DropError(e))
+			return
+		}
+		c.fail(link,fetchFailure(e))
+		return
+	}
+	c.onResponse(link,response)
+	//relative links are resolved against final url after redirects
+	base, e := url.Parse(response.Url)
+	if e != nil {
+		base, e = url.Parse(link.Url)
+	}
+	if e != nil {
+		c.fail(link,DropError(fmt.Errorf("url: %s no base to resolve links. Error: %v",link.Url,e)))
 		return
 	}
 	//process result
-	links := c.processor.Process(link,html)
-	//send link to fetch
+	links, e := c.process(link,string(response.Body))
+	if e != nil {
+		c.fail(link,e)
+		return
+	}
+	if c.isDraining() { //draining: only links queued before stop
+		links = nil
+	}
+	links = c.childLinks(link,base,links)
+	//count links before push, so pending never hits 0 while they are on the way
+	atomic.AddInt64(&c.pending,int64(len(links)))
+	//push link to fetch, never blocks
 	for _,link := range links {
-		c.urlChannel <- link
+		if e := c.frontier.Push(link); e != nil {
+			c.dropLink(link,e)
+			atomic.AddInt64(&c.pending,-1)
+		}
 	}
 	time.Sleep(c.WaitTime)
-	c.resultChannel <- StatusSuccess
+	c.resultChannel <- &fetchResult{link: link, status: StatusSuccess, bytes: len(response.Body)}
 }
@@ -2,9 +2,17 @@ package crawler
 
 import (
 	"bytes"
+	"cake/network"
 	"cake/util/datastruct"
 	"github.com/PuerkitoBio/goquery"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type cnblogs struct {
@@ -53,4 +61,260 @@ func TestCrawler_Start(t *testing.T) {
 	cb := NewCNBlogs()
 	c := CreateCrawler(cb,cb,cb.startLink)
 	c.Start()
-}
\ No newline at end of file
+}
+//local site for crawler tests: path -> linked paths
+type testSite struct {
+	server  *httptest.Server
+	urlPool *datastruct.HashSet
+	lock    sync.Mutex //processor and filter are called concurrently
+	visited []string
+	delay   time.Duration //every response is delayed
+}
+
+func createTestSite(pages map[string][]string) *testSite {
+	site := &testSite{urlPool: datastruct.CreateHashSet("test-site")}
+	site.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(site.delay)
+		links, ok := pages[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		html := "<html><body>"
+		for _, link := range links {
+			html += "<a href=\"" + link + "\">" + link + "</a>"
+		}
+		_, _ = w.Write([]byte(html + "</body></html>"))
+	}))
+	return site
+}
+
+func (s *testSite) Process(link *Link, html string) []*Link {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(html)))
+	if err != nil {
+		return nil
+	}
+	s.lock.Lock()
+	s.visited = append(s.visited, link.Url)
+	s.lock.Unlock()
+	var links []*Link
+	doc.Find("a").Each(func(i int, selection *goquery.Selection) {
+		if href, exists := selection.Attr("href"); exists {
+			links = append(links, &Link{Url: s.server.URL + href})
+		}
+	})
+	return links
+}
+
+func (s *testSite) CheckDuplicate(url string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.urlPool.Add(url)
+}
+
+func TestCrawler_Finish(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/b", "/c", "/missing"},
+		"/b": {"/"},
+		"/c": {},
+	})
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = 0
+	start := time.Now()
+	c.Start()
+	if cost := time.Since(start); cost > 5*time.Second {
+		t.Errorf("crawler should finish at once, cost: %v", cost)
+	}
+	if c.CurrentFetchedPages != 4 || c.CurrentFailPages != 1 {
+		t.Errorf("expected 4 fetched 1 fail, got %d %d", c.CurrentFetchedPages, c.CurrentFailPages)
+	}
+}
+
+func TestCrawler_WorkerPool(t *testing.T) {
+	pages := map[string][]string{"/": nil}
+	for i := 0; i < 50; i++ {
+		pages["/"] = append(pages["/"], "/"+strconv.Itoa(i))
+		pages["/"+strconv.Itoa(i)] = nil
+	}
+	site := createTestSite(pages)
+	defer site.server.Close()
+	var current, max int32
+	handler := site.server.Config.Handler
+	site.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			old := atomic.LoadInt32(&max)
+			if n <= old || atomic.CompareAndSwapInt32(&max, old, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		handler.ServeHTTP(w, r)
+		atomic.AddInt32(&current, -1)
+	})
+	c := CreateCrawlerByOptions(site, site, site.server.URL+"/", &CrawlerOptions{
+		MaxConnections: 20,
+		Workers:        3,
+		WaitTime:       NoWait,
+	})
+	if c.WaitTime != 0 {
+		t.Errorf("NoWait should not wait, got %v", c.WaitTime)
+	}
+	c.Start()
+	if c.CurrentFetchedPages != 51 {
+		t.Errorf("expected 51 pages got %d", c.CurrentFetchedPages)
+	}
+	if max > 3 {
+		t.Errorf("more requests than workers at the same time: %d", max)
+	}
+}
+
+//list page emits three POST requests of one url
+type postProcessor struct {
+	server *httptest.Server
+}
+
+func (p *postProcessor) Process(link *Link, html string) []*Link {
+	if link.Method != "" {
+		return nil
+	}
+	var links []*Link
+	for page := 1; page <= 3; page++ {
+		method := http.MethodPost
+		if page == 2 {
+			method = "post" //same key as POST
+		}
+		links = append(links, &Link{
+			Url:     p.server.URL + "/api",
+			Method:  method,
+			Body:    []byte("page=" + strconv.Itoa(page)),
+			Headers: map[string]string{"User-Agent": "cake-test"},
+			Cookies: map[string]string{"session": "abc"},
+		})
+	}
+	return links
+}
+
+//url filter remembers what it was given
+type recordingFilter struct {
+	*testSite
+	checked []string
+}
+
+func (f *recordingFilter) CheckDuplicate(url string) bool {
+	f.lock.Lock()
+	f.checked = append(f.checked, url)
+	f.lock.Unlock()
+	return f.testSite.CheckDuplicate(url)
+}
+
+func TestCrawler_LinkRequest(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	var failed int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		cookie, _ := r.Cookie("session")
+		if r.Method != http.MethodPost || r.UserAgent() != "cake-test" || r.Referer() != "http://"+r.Host+"/" || cookie == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if string(body) == "page=3" { //form may be saved, must not be sent again
+			atomic.AddInt32(&failed, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		lock.Lock()
+		bodies = append(bodies, string(body))
+		lock.Unlock()
+	}))
+	defer server.Close()
+	filter := &recordingFilter{testSite: &testSite{urlPool: datastruct.CreateHashSet("post-site")}}
+	c := CreateCrawler(&postProcessor{server: server}, filter, server.URL+"/")
+	c.WaitTime = 0
+	c.RetryDelay = time.Millisecond
+	c.Start()
+	stats := c.Stats()
+	if stats.Fetched != 3 || stats.Duplicates != 0 || len(bodies) != 2 {
+		t.Errorf("both POST pages should be fetched: %+v %v", stats, bodies)
+	}
+	if n := atomic.LoadInt32(&failed); n != 1 || stats.Failed != 1 || stats.Retried != 0 {
+		t.Errorf("failed POST should be sent once, sent %d times: %+v", n, stats)
+	}
+	if len(filter.checked) != 1 || filter.checked[0] != server.URL+"/" {
+		t.Errorf("url filter should only get urls of GET links: %v", filter.checked)
+	}
+	if (&Link{Url: "http://a.com/", Method: "get"}).key() != "http://a.com/" {
+		t.Errorf("method case should not change key")
+	}
+}
+
+//processor keeps links it returned, like a cache of found links
+type keepingProcessor struct {
+	*testSite
+	kept [][]*Link
+}
+
+func (p *keepingProcessor) Process(link *Link, html string) []*Link {
+	links := []*Link{nil, {Url: "/a"}}
+	p.lock.Lock()
+	p.kept = append(p.kept, links)
+	p.lock.Unlock()
+	return links
+}
+
+func TestCrawler_ChildLinksCopied(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": nil, "/a": nil})
+	defer site.server.Close()
+	processor := &keepingProcessor{testSite: site}
+	c := CreateCrawler(processor, site, site.server.URL+"/")
+	c.WaitTime = NoWait
+	c.Start()
+	if c.CurrentFetchedPages != 2 {
+		t.Errorf("expected 2 pages got %d", c.CurrentFetchedPages)
+	}
+	for _, links := range processor.kept {
+		if len(links) != 2 || links[0] != nil || links[1].Url != "/a" || links[1].Depth != 0 || links[1].Referer != "" {
+			t.Errorf("links of processor should not change: %+v", links)
+		}
+	}
+}
+
+func TestLink_Clone(t *testing.T) {
+	link := &Link{Url: "http://a.com/", Headers: map[string]string{"A": "1"}, Cookies: map[string]string{"b": "2"}, Body: []byte("c")}
+	link.SetMeta("d", 4)
+	clone := link.clone()
+	clone.Headers["A"] = "x"
+	clone.Cookies["b"] = "x"
+	clone.Body[0] = 'x'
+	clone.SetMeta("d", "x")
+	if link.Headers["A"] != "1" || link.Cookies["b"] != "2" || string(link.Body) != "c" || link.Meta.Get("d") != 4 {
+		t.Errorf("clone should not share maps and body: %+v", link)
+	}
+}
+
+func TestCrawler_HeaderProfileAgent(t *testing.T) {
+	var agents []string
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		agents = append(agents, r.UserAgent())
+		lock.Unlock()
+	}))
+	defer server.Close()
+	site := &testSite{urlPool: datastruct.CreateHashSet("agent-site")}
+	c := CreateCrawler(site, site, server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	if e := c.HttpEngine().UseHeaderProfile(network.ProfileMobileSafari); e != nil {
+		t.Fatal(e)
+	}
+	c.Start()
+	if len(agents) != 1 || agents[0] != network.HeaderProfiles[network.ProfileMobileSafari]["User-Agent"] {
+		t.Errorf("profile agent should be sent: %v", agents)
+	}
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"bytes"
+	"github.com/PuerkitoBio/goquery"
+	"strings"
+)
+
+//tag -> attribute holds a link to a page, used when LinkExtractor.Tags is empty
+var DefaultLinkTags = map[string]string{
+	"a":    "href",
+	"area": "href",
+}
+
+//tags of stylesheets, images and frames, not followed unless IncludeAssets is used
+var AssetLinkTags = map[string]string{
+	"link":   "href",
+	"img":    "src",
+	"iframe": "src",
+	"frame":  "src",
+}
+
+//links with these schemes are never followed
+var skippedLinkSchemes = []string{"javascript:", "mailto:", "tel:", "data:"}
+
+//LinkExtractor finds links in html. links are returned as written in page,
+//crawler resolves them against the page url
+type LinkExtractor struct {
+	Tags      map[string]string //tag -> attribute, empty uses DefaultLinkTags
+	Selectors []string          //only look inside these elements, empty is the whole page
+}
+
+//extractor of DefaultLinkTags inside selectors
+func CreateLinkExtractor(selectors ...string) *LinkExtractor {
+	return &LinkExtractor{Selectors: selectors}
+}
+
+//follow AssetLinkTags too, their bodies are passed to Processor like pages
+func (x *LinkExtractor) IncludeAssets() *LinkExtractor {
+	tags := make(map[string]string, len(DefaultLinkTags)+len(AssetLinkTags))
+	for _, from := range []map[string]string{DefaultLinkTags, AssetLinkTags, x.Tags} {
+		for tag, attr := range from {
+			tags[tag] = attr
+		}
+	}
+	x.Tags = tags
+	return x
+}
+
+//links of html, duplicate ones in the same page are removed
+func (x *LinkExtractor) ExtractHtml(html string) ([]*Link, error) {
+	doc, e := goquery.NewDocumentFromReader(bytes.NewReader([]byte(html)))
+	if e != nil {
+		return nil, e
+	}
+	return x.Extract(doc.Selection), nil
+}
+
+//links inside selection
+func (x *LinkExtractor) Extract(selection *goquery.Selection) []*Link {
+	tags := x.Tags
+	if len(tags) == 0 {
+		tags = DefaultLinkTags
+	}
+	roots := []*goquery.Selection{selection}
+	if len(x.Selectors) > 0 {
+		roots = roots[:0]
+		for _, selector := range x.Selectors {
+			roots = append(roots, selection.Find(selector))
+		}
+	}
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	selector := strings.Join(names, ",")
+	var links []*Link
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		//root itself may be the tag, like Selectors: "a.next". links are in document order
+		root.Filter(selector).AddSelection(root.Find(selector)).Each(func(i int, s *goquery.Selection) {
+			href, ok := s.Attr(tags[goquery.NodeName(s)])
+			href = strings.TrimSpace(href)
+			if !ok || !followable(href) || seen[href] {
+				return
+			}
+			seen[href] = true
+			links = append(links, &Link{Url: href})
+		})
+	}
+	return links
+}
+
+//not empty, not a fragment of the same page and not a script
+func followable(href string) bool {
+	if href == "" || strings.HasPrefix(href, "#") {
+		return false
+	}
+	lower := strings.ToLower(href)
+	for _, scheme := range skippedLinkSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, path string) string {
+	content, e := os.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return string(content)
+}
+
+func linkUrls(links []*Link) string {
+	var urls []string
+	for _, link := range links {
+		urls = append(urls, link.Url)
+	}
+	return strings.Join(urls, " ")
+}
+
+func TestLinkExtractor(t *testing.T) {
+	html := readFixture(t, "testdata/list.html")
+	links, e := CreateLinkExtractor().ExtractHtml(html)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := "/ /post/1 /post/2 /page/2 /page/3"
+	if urls := linkUrls(links); urls != expected {
+		t.Errorf("expected: %s got: %s", expected, urls)
+	}
+	links, _ = CreateLinkExtractor().IncludeAssets().ExtractHtml(html)
+	expected = "/style.css / /post/1 /img/1.png /post/2 /page/2 /page/3"
+	if urls := linkUrls(links); urls != expected {
+		t.Errorf("expected with assets: %s got: %s", expected, urls)
+	}
+	x := &LinkExtractor{Tags: map[string]string{"a": "href"}, Selectors: []string{"div.pager", "a.title"}}
+	links, _ = x.ExtractHtml(html)
+	if urls := linkUrls(links); urls != "/page/2 /page/3 /post/1 /post/2" {
+		t.Errorf("wrong links in selectors: %s", urls)
+	}
+}
@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//retries of a link by default
+const DefaultMaxRetries = 3
+
+//how crawler handles a failed link
+const (
+	FailureDrop  = iota //give up the link, keep it in dead letters
+	FailureRetry        //fetch it again after a delay, dropped after MaxRetries
+	FailureFatal        //give up the link and stop crawler
+)
+
+//ErrorProcessor is a Processor reports failures.
+//links are not followed when error is returned
+type ErrorProcessor interface {
+	Processor
+	ProcessWithError(link *Link, html string) ([]*Link, error)
+}
+
+//ProcessError tells crawler how to handle the failure
+type ProcessError struct {
+	Kind int //FailureDrop, FailureRetry or FailureFatal
+	Err  error
+}
+
+func (e *ProcessError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProcessError) Unwrap() error {
+	return e.Err
+}
+
+//link should be fetched again later, like page is not ready yet
+func RetryLaterError(e error) error {
+	return &ProcessError{Kind: FailureRetry, Err: e}
+}
+
+//link can never be processed, like page is broken
+func DropError(e error) error {
+	return &ProcessError{Kind: FailureDrop, Err: e}
+}
+
+//crawl can't go on, like site changed its layout
+func FatalError(e error) error {
+	return &ProcessError{Kind: FailureFatal, Err: e}
+}
+
+//kind of ProcessError, FailureDrop for other errors
+func FailureKind(e error) int {
+	var processError *ProcessError
+	if errors.As(e, &processError) {
+		return processError.Kind
+	}
+	return FailureDrop
+}
+
+//DeadLetter is a link crawler gave up with its reason
+type DeadLetter struct {
+	Link   *Link     `json:"link"`
+	Reason string    `json:"reason"`
+	Kind   int       `json:"kind"`
+	Time   time.Time `json:"time"`
+}
+
+//failed links kept after crawl
+type deadLetters struct {
+	letters []*DeadLetter
+	lock    sync.Mutex
+}
+
+func (d *deadLetters) add(link *Link, kind int, e error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.letters = append(d.letters, &DeadLetter{Link: link, Reason: e.Error(), Kind: kind, Time: time.Now()})
+}
+
+//links given up so far
+func (c *Crawler) DeadLetters() []*DeadLetter {
+	c.deadLetters.lock.Lock()
+	defer c.deadLetters.lock.Unlock()
+	letters := make([]*DeadLetter, len(c.deadLetters.letters))
+	copy(letters, c.deadLetters.letters)
+	return letters
+}
+
+//write dead letters to file as json lines
+func (c *Crawler) ExportDeadLetters(path string) error {
+	file, e := os.Create(path)
+	if e != nil {
+		return fmt.Errorf("[DeadLetter] Create: %s Error: %v", path, e)
+	}
+	writer := bufio.NewWriter(file)
+	for _, letter := range c.DeadLetters() {
+		content, e := json.Marshal(letter)
+		if e != nil {
+			_ = file.Close()
+			return fmt.Errorf("[DeadLetter] Marshal link: %s Error: %v", letter.Link.Url, e)
+		}
+		if _, e := writer.Write(append(content, '\n')); e != nil {
+			_ = file.Close()
+			return fmt.Errorf("[DeadLetter] Write: %s Error: %v", path, e)
+		}
+	}
+	if e := writer.Flush(); e != nil {
+		_ = file.Close()
+		return fmt.Errorf("[DeadLetter] Write: %s Error: %v", path, e)
+	}
+	return file.Close()
+}
+
+//kind of failure, ClassifyFailure decides first if set
+func (c *Crawler) classify(link *Link, e error) int {
+	if c.ClassifyFailure != nil {
+		return c.ClassifyFailure(link, e)
+	}
+	return FailureKind(e)
+}
+
+//handle failed link in worker: queue it again, give it up or stop crawler
+func (c *Crawler) fail(link *Link, e error) {
+	c.onError(link, e)
+	kind := c.classify(link, e)
+	if kind == FailureRetry && link.Attempts < c.MaxRetries && !c.isShutdown() {
+		//a copy, hooks and processor may still hold the failed one.
+		//failed one stays pending in frontier until retry is pushed, so a crash doesn't lose it
+		retry := link.clone()
+		retry.Attempts += 1
+		delay := c.retryDelay(retry.Attempts)
+		atomic.AddInt64(&c.pending, 1) //retry is pending until it is fetched
+		c.retries.add(retry, link, delay)
+		logger.WarnF("url: %s Error: %v. Retry %d/%d after %v", link.Url, e, retry.Attempts, c.MaxRetries, delay)
+		c.resultChannel <- &fetchResult{link: link, status: StatusRetry}
+		return
+	}
+	logger.ErrorF("url: %s given up. Error: %v", link.Url, e)
+	c.deadLetters.add(link, kind, e)
+	if kind == FailureFatal {
+		c.stopWith(StopReasonFatal)
+	}
+	c.resultChannel <- &fetchResult{link: link, status: StatusFail}
+}
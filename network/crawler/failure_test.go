@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//processor fails pages by path: /flaky-N fails N times, /broken always, /fatal stops crawl
+type failingProcessor struct {
+	*testSite
+	lock     sync.Mutex
+	attempts map[string]int
+}
+
+func (p *failingProcessor) ProcessWithError(link *Link, html string) ([]*Link, error) {
+	p.lock.Lock()
+	p.attempts[link.Url] += 1
+	attempts := p.attempts[link.Url]
+	p.lock.Unlock()
+	switch {
+	case strings.HasSuffix(link.Url, "/flaky"):
+		if attempts <= 2 {
+			return nil, RetryLaterError(fmt.Errorf("not ready"))
+		}
+	case strings.HasSuffix(link.Url, "/broken"):
+		return nil, DropError(fmt.Errorf("broken page"))
+	case strings.HasSuffix(link.Url, "/fatal"):
+		return nil, FatalError(fmt.Errorf("layout changed"))
+	case strings.HasSuffix(link.Url, "/never"):
+		return nil, RetryLaterError(fmt.Errorf("never ready"))
+	}
+	return p.testSite.Process(link, html), nil
+}
+
+func createFailingProcessor(pages map[string][]string) *failingProcessor {
+	return &failingProcessor{testSite: createTestSite(pages), attempts: make(map[string]int)}
+}
+
+func TestFailureKind(t *testing.T) {
+	if FailureKind(fmt.Errorf("plain")) != FailureDrop {
+		t.Errorf("plain error should be dropped")
+	}
+	wrapped := fmt.Errorf("wrapped: %w", RetryLaterError(fmt.Errorf("later")))
+	if FailureKind(wrapped) != FailureRetry || wrapped.Error() != "wrapped: later" {
+		t.Errorf("wrapped retry error not found: %v", wrapped)
+	}
+}
+
+func TestCrawler_ProcessorFailures(t *testing.T) {
+	p := createFailingProcessor(map[string][]string{
+		"/":       {"/flaky", "/broken", "/never"},
+		"/flaky":  {"/after"},
+		"/broken": nil,
+		"/never":  nil,
+		"/after":  nil,
+	})
+	defer p.server.Close()
+	c := CreateCrawler(p, p.testSite, p.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.MaxRetries = 2
+	c.RetryDelay = 20 * time.Millisecond
+	start := time.Now()
+	c.Start()
+	if cost := time.Since(start); cost < 60*time.Millisecond {
+		t.Errorf("retries should wait 20ms then 40ms, cost: %v", cost)
+	}
+	//"/", "/flaky" on 3rd try and "/after"
+	if c.CurrentFetchedPages != 3 || c.CurrentFailPages != 2 {
+		t.Errorf("expected 3 fetched 2 fail, got %d %d", c.CurrentFetchedPages, c.CurrentFailPages)
+	}
+	if c.Stats().Retried != 4 {
+		t.Errorf("expected 4 retries got %d", c.Stats().Retried)
+	}
+	letters := c.DeadLetters()
+	if len(letters) != 2 {
+		t.Fatalf("expected 2 dead letters got %d", len(letters))
+	}
+	reasons := map[string]string{}
+	for _, letter := range letters {
+		reasons[strings.TrimPrefix(letter.Link.Url, p.server.URL)] = letter.Reason
+	}
+	if reasons["/broken"] != "broken page" || reasons["/never"] != "never ready" {
+		t.Errorf("wrong dead letters: %v", reasons)
+	}
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	if e := c.ExportDeadLetters(path); e != nil {
+		t.Fatal(e)
+	}
+	file, _ := os.Open(path)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lines := 0
+	for scanner.Scan() {
+		letter := &DeadLetter{}
+		if e := json.Unmarshal(scanner.Bytes(), letter); e != nil || letter.Link == nil {
+			t.Errorf("bad dead letter line: %s", scanner.Text())
+		}
+		if strings.HasSuffix(letter.Link.Url, "/never") && letter.Link.Attempts != 2 {
+			t.Errorf("expected 2 attempts got %d", letter.Link.Attempts)
+		}
+		lines += 1
+	}
+	if lines != 2 {
+		t.Errorf("expected 2 lines got %d", lines)
+	}
+}
+
+func TestCrawler_FatalFailure(t *testing.T) {
+	p := createFailingProcessor(map[string][]string{
+		"/":      {"/fatal"},
+		"/fatal": {"/next"},
+		"/next":  nil,
+	})
+	defer p.server.Close()
+	c := CreateCrawler(p, p.testSite, p.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.Start()
+	if c.StopReason() != StopReasonFatal {
+		t.Errorf("wrong stop reason: %s", c.StopReason())
+	}
+	if c.CurrentFetchedPages != 1 || len(c.DeadLetters()) != 1 {
+		t.Errorf("expected 1 fetched 1 dead letter, got %d %d", c.CurrentFetchedPages, len(c.DeadLetters()))
+	}
+}
@@ -0,0 +1,324 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Frontier is the queue of links waiting to be fetched
+//crawler pops a link, fetches it and calls Done when the link is finished
+//implementations must be thread safe
+type Frontier interface {
+	//add link to fetch
+	Push(link *Link) error
+	//take next link, nil when empty
+	Pop() (*Link, error)
+	//popped link is finished: fetched, failed or dropped
+	Done(link *Link) error
+	//links waiting, not include popped ones
+	Len() int
+	Close() error
+}
+
+//PersistentFrontier can save its state, crawler calls Checkpoint periodically
+type PersistentFrontier interface {
+	Frontier
+	Checkpoint() error
+}
+
+//in memory FIFO frontier, all links lost when process exit
+type MemoryFrontier struct {
+	queue []*Link
+	lock  sync.Mutex
+}
+
+func CreateMemoryFrontier() *MemoryFrontier {
+	return &MemoryFrontier{}
+}
+
+func (f *MemoryFrontier) Push(link *Link) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.queue = append(f.queue, link)
+	return nil
+}
+
+func (f *MemoryFrontier) Pop() (*Link, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.queue) == 0 {
+		return nil, nil
+	}
+	link := f.queue[0]
+	f.queue[0] = nil //let gc collect it
+	f.queue = f.queue[1:]
+	return link, nil
+}
+
+func (f *MemoryFrontier) Done(link *Link) error {
+	return nil
+}
+
+func (f *MemoryFrontier) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.queue)
+}
+
+func (f *MemoryFrontier) Close() error {
+	return nil
+}
+
+//compact log when this many links are done since last compact
+const frontierCompactSize = 10000
+
+type frontierEntry struct {
+	id   uint64
+	link *Link
+}
+
+//FileFrontier is a FIFO frontier backed by an append-only log file
+//log lines: "+id {link json}" for push, "-id" for done.
+//links popped but not done are still pending in the log, so a crash never lose them
+//when the file is opened again, pending links are loaded in order
+type FileFrontier struct {
+	path      string
+	file      *os.File
+	writer    *bufio.Writer
+	queue     []*frontierEntry          //not popped
+	taken     map[*Link]*frontierEntry //popped but not done
+	nextId    uint64
+	doneCount int //done since last compact
+	lock      sync.Mutex
+}
+
+func (f *FileFrontier) savesLinks() {}
+
+//open or create log file and load pending links from it
+func CreateFileFrontier(path string) (*FileFrontier, error) {
+	f := &FileFrontier{
+		path:  path,
+		taken: make(map[*Link]*frontierEntry),
+	}
+	if e := f.load(); e != nil {
+		return nil, e
+	}
+	//rewrite log without finished links
+	if e := f.compact(); e != nil {
+		return nil, e
+	}
+	if len(f.queue) > 0 {
+		logger.InfoF("[Frontier] Loaded %d links from: %s", len(f.queue), path)
+	}
+	return f, nil
+}
+
+//replay log file
+func (f *FileFrontier) load() error {
+	file, e := os.Open(f.path)
+	if os.IsNotExist(e) {
+		return nil
+	}
+	if e != nil {
+		return fmt.Errorf("[Frontier] Open: %s Error: %v", f.path, e)
+	}
+	defer func() {
+		e := file.Close()
+		if e != nil {
+			logger.WarnF("[Frontier] Close: %s Error: %v", f.path, e)
+		}
+	}()
+	entries := make(map[uint64]*frontierEntry)
+	var order []uint64
+	reader := bufio.NewReader(file)
+	for {
+		line, e := reader.ReadString('\n')
+		if e == io.EOF && !strings.HasSuffix(line, "\n") {
+			break //last line was not fully written before crash. ignore it
+		}
+		if e != nil {
+			return fmt.Errorf("[Frontier] Read: %s Error: %v", f.path, e)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if len(line) < 2 {
+			continue
+		}
+		switch line[0] {
+		case '+':
+			space := strings.IndexByte(line, ' ')
+			if space < 0 {
+				return fmt.Errorf("[Frontier] Bad line in: %s -> %s", f.path, line)
+			}
+			id, e := strconv.ParseUint(line[1:space], 10, 64)
+			if e != nil {
+				return fmt.Errorf("[Frontier] Bad id in: %s -> %s", f.path, line)
+			}
+			link := &Link{}
+			if e := json.Unmarshal([]byte(line[space+1:]), link); e != nil {
+				return fmt.Errorf("[Frontier] Bad link in: %s -> %v", f.path, e)
+			}
+			entries[id] = &frontierEntry{id: id, link: link}
+			order = append(order, id)
+		case '-':
+			id, e := strconv.ParseUint(line[1:], 10, 64)
+			if e != nil {
+				return fmt.Errorf("[Frontier] Bad id in: %s -> %s", f.path, line)
+			}
+			delete(entries, id)
+		}
+	}
+	for _, id := range order {
+		if entry, ok := entries[id]; ok {
+			f.queue = append(f.queue, entry)
+		}
+		if id >= f.nextId {
+			f.nextId = id + 1
+		}
+	}
+	return nil
+}
+
+//rewrite log with pending links only: popped ones first then queue.must hold lock
+func (f *FileFrontier) compact() error {
+	if f.writer != nil {
+		if e := f.writer.Flush(); e != nil {
+			return e
+		}
+		if e := f.file.Close(); e != nil {
+			return e
+		}
+		f.writer, f.file = nil, nil
+	}
+	tmpPath := f.path + ".tmp"
+	file, e := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if e != nil {
+		return fmt.Errorf("[Frontier] Create: %s Error: %v", tmpPath, e)
+	}
+	writer := bufio.NewWriter(file)
+	var taken []*frontierEntry
+	for _, entry := range f.taken {
+		taken = append(taken, entry)
+	}
+	for _, entry := range append(sortEntries(taken), f.queue...) {
+		if e := writeEntry(writer, entry); e != nil {
+			_ = file.Close()
+			return e
+		}
+	}
+	if e := writer.Flush(); e != nil {
+		_ = file.Close()
+		return e
+	}
+	if e := file.Sync(); e != nil {
+		_ = file.Close()
+		return e
+	}
+	if e := file.Close(); e != nil {
+		return e
+	}
+	if e := os.Rename(tmpPath, f.path); e != nil {
+		return fmt.Errorf("[Frontier] Rename: %s Error: %v", tmpPath, e)
+	}
+	f.file, e = os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		return fmt.Errorf("[Frontier] Open: %s Error: %v", f.path, e)
+	}
+	f.writer = bufio.NewWriter(f.file)
+	f.doneCount = 0
+	return nil
+}
+
+//entries by id, that is push order
+func sortEntries(entries []*frontierEntry) []*frontierEntry {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	return entries
+}
+
+func writeEntry(writer *bufio.Writer, entry *frontierEntry) error {
+	content, e := json.Marshal(entry.link)
+	if e != nil {
+		return fmt.Errorf("[Frontier] Marshal link: %s Error: %v", entry.link.Url, e)
+	}
+	_, e = writer.WriteString("+" + strconv.FormatUint(entry.id, 10) + " " + string(content) + "\n")
+	return e
+}
+
+func (f *FileFrontier) Push(link *Link) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	entry := &frontierEntry{id: f.nextId, link: link}
+	if e := writeEntry(f.writer, entry); e != nil {
+		return e
+	}
+	f.nextId += 1
+	f.queue = append(f.queue, entry)
+	return nil
+}
+
+func (f *FileFrontier) Pop() (*Link, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.queue) == 0 {
+		return nil, nil
+	}
+	entry := f.queue[0]
+	f.queue[0] = nil
+	f.queue = f.queue[1:]
+	f.taken[entry.link] = entry
+	return entry.link, nil
+}
+
+func (f *FileFrontier) Done(link *Link) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	entry, ok := f.taken[link]
+	if !ok {
+		return fmt.Errorf("[Frontier] Link: %s was not popped", link.Url)
+	}
+	delete(f.taken, link)
+	if _, e := f.writer.WriteString("-" + strconv.FormatUint(entry.id, 10) + "\n"); e != nil {
+		return e
+	}
+	f.doneCount += 1
+	if f.doneCount >= frontierCompactSize {
+		return f.compact()
+	}
+	return nil
+}
+
+func (f *FileFrontier) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.queue)
+}
+
+//flush log to disk
+func (f *FileFrontier) Checkpoint() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if e := f.writer.Flush(); e != nil {
+		return e
+	}
+	return f.file.Sync()
+}
+
+func (f *FileFrontier) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	if e := f.writer.Flush(); e != nil {
+		return e
+	}
+	e := f.file.Close()
+	f.file, f.writer = nil, nil
+	return e
+}
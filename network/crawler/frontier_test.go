@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"cake/util/datastruct"
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryFrontier(t *testing.T) {
+	f := CreateMemoryFrontier()
+	for i := 0; i < 3; i++ {
+		_ = f.Push(&Link{Url: strconv.Itoa(i)})
+	}
+	for i := 0; i < 3; i++ {
+		link, _ := f.Pop()
+		if link == nil || link.Url != strconv.Itoa(i) {
+			t.Fatalf("wrong order at %d: %v", i, link)
+		}
+	}
+	if link, _ := f.Pop(); link != nil {
+		t.Errorf("frontier should be empty")
+	}
+}
+
+func TestFileFrontier_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontier.log")
+	f, e := CreateFileFrontier(path)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	for i := 0; i < 5; i++ {
+		if e := f.Push(&Link{Url: strconv.Itoa(i), AttrMap: map[string]string{"n": strconv.Itoa(i)}}); e != nil {
+			t.Fatalf("%v", e)
+		}
+	}
+	first, _ := f.Pop()
+	second, _ := f.Pop()
+	if e := f.Done(first); e != nil {
+		t.Fatalf("%v", e)
+	}
+	//second is popped but not done, like a crash in fetching
+	if e := f.Close(); e != nil {
+		t.Fatalf("%v", e)
+	}
+	f, e = CreateFileFrontier(path)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	defer f.Close()
+	if f.Len() != 4 {
+		t.Fatalf("expected 4 pending links, got %d", f.Len())
+	}
+	for _, expected := range []string{second.Url, "2", "3", "4"} {
+		link, _ := f.Pop()
+		if link.Url != expected || link.AttrMap["n"] != expected {
+			t.Errorf("expected %s got %+v", expected, link)
+		}
+	}
+}
+
+func TestCrawler_CheckpointResume(t *testing.T) {
+	checkpointResume(t, nil)
+}
+
+//checkpoint logs links of any frontier, set before or after EnableCheckpoint
+func TestCrawler_CheckpointFrontier(t *testing.T) {
+	checkpointResume(t, func(c *Crawler) { c.SetFrontier(CreateSpillingFrontier(2, t.TempDir())) })
+	checkpointResume(t, func(c *Crawler) { c.SetFrontier(CreatePriorityFrontier(true)) })
+}
+
+//crawl stops in the middle and a new crawler goes on from checkpoint
+//setFrontier is called after EnableCheckpoint if not nil
+func checkpointResume(t *testing.T, setFrontier func(c *Crawler)) {
+	//chain: / -> /1 -> /2 ... -> /20, fan out /n -> /n-a
+	pages := map[string][]string{"/": {"/1"}}
+	for i := 1; i <= 20; i++ {
+		pages["/"+strconv.Itoa(i)] = []string{"/" + strconv.Itoa(i+1), "/" + strconv.Itoa(i) + "-a"}
+		pages["/"+strconv.Itoa(i)+"-a"] = nil
+	}
+	pages["/20"] = nil
+	site := createTestSite(pages)
+	defer site.server.Close()
+	site.delay = 30 * time.Millisecond
+	dir := t.TempDir()
+
+	c := CreateCrawlerByMaxThreads(1, site, site, site.server.URL+"/")
+	c.WaitTime = 0
+	if e := c.EnableCheckpoint(dir, time.Second); e != nil {
+		t.Fatalf("%v", e)
+	}
+	if setFrontier != nil {
+		setFrontier(c)
+	}
+	handle, e := c.StartAsync()
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	time.Sleep(150 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if e := c.Stop(ctx); e != nil {
+		t.Fatalf("%v", e)
+	}
+	handle.Wait()
+	firstRun := len(site.visited)
+	if firstRun == 0 || firstRun == 40 {
+		t.Fatalf("stop should happen in the middle, visited %d", firstRun)
+	}
+
+	//new crawler with fresh business filter goes on from checkpoint
+	site.urlPool = datastruct.CreateHashSet("test-site")
+	c = CreateCrawlerByMaxThreads(5, site, site, site.server.URL+"/")
+	c.WaitTime = 0
+	if e := c.EnableCheckpoint(dir, time.Second); e != nil {
+		t.Fatalf("%v", e)
+	}
+	if setFrontier != nil {
+		setFrontier(c)
+	}
+	c.Start()
+	seen := make(map[string]bool)
+	for _, url := range site.visited {
+		if seen[url] {
+			t.Errorf("url fetched twice: %s", url)
+		}
+		seen[url] = true
+	}
+	if len(seen) != 40 {
+		t.Errorf("expected 40 pages after resume, got %d", len(seen))
+	}
+}
+
+func TestCheckpoint_Journal(t *testing.T) {
+	dir := t.TempDir()
+	c := CreateCrawler(nil, nil, "")
+	if e := c.EnableCheckpoint(dir, time.Second); e != nil {
+		t.Fatalf("%v", e)
+	}
+	f, e := c.checkpoint.wrap(CreateMemoryFrontier())
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	for i := 0; i < 4; i++ {
+		if e := f.Push(&Link{Url: strconv.Itoa(i)}); e != nil {
+			t.Fatalf("%v", e)
+		}
+	}
+	first, _ := f.Pop()
+	second, _ := f.Pop()
+	if e := f.Done(first); e != nil {
+		t.Fatalf("%v", e)
+	}
+	journal := f.(*journalFrontier)
+	journal.lock.Lock()
+	e = journal.compact(nil) //pending entries copied from log
+	journal.lock.Unlock()
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if e := f.Done(second); e != nil {
+		t.Fatalf("%v", e)
+	}
+	//crash: log is flushed but frontier is not closed
+	if e := c.checkpoint.save(f); e != nil {
+		t.Fatalf("%v", e)
+	}
+	c = CreateCrawler(nil, nil, "")
+	if e := c.EnableCheckpoint(dir, time.Second); e != nil {
+		t.Fatalf("%v", e)
+	}
+	f, e = c.checkpoint.wrap(CreateMemoryFrontier())
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	defer f.Close()
+	for _, expected := range []string{"2", "3"} {
+		if link, _ := f.Pop(); link == nil || link.Url != expected {
+			t.Errorf("expected %s got %+v", expected, link)
+		}
+	}
+	if f.Len() != 0 {
+		t.Errorf("done links should not come back: %d left", f.Len())
+	}
+}
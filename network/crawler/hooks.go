@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"cake/network"
+)
+
+//Hooks are called on crawl events, nil ones are skipped. set them before Start.
+//hooks are called from many go routines at the same time: OnRequest, OnResponse, OnError
+//and OnLinkDiscovered by workers, the others by fetch loop. they must be safe for concurrent use
+//and return quickly, a slow hook slows the crawl. a panic in a hook is recovered and logged.
+//to end the crawl early from a hook, call Crawler.Stop in a new go route,
+//Stop waits for workers and a hook runs in one of them.
+//OnResponse sees every response: a 200 page before it is processed, other status after retries
+//of engine are used up, with header and body. then the link comes to OnError as *network.StatusError
+type Hooks struct {
+	OnRequest        func(link *Link)                             //before link is fetched
+	OnResponse       func(link *Link, response *network.Response) //response of link, check StatusCode
+	OnError          func(link *Link, e error)                    //fetch or process failed, also when it will be retried
+	OnLinkDiscovered func(parent *Link, link *Link)               //link found in parent is queued
+	OnDuplicate      func(link *Link)                             //link skipped as duplicate
+	OnIdle           func()                                       //nothing queued or fetching
+	OnFinish         func(stats *Stats)                           //crawler finished, everything is closed
+}
+
+//run hook, a panic doesn't break crawler
+func callHook(name string, hook func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.ErrorF("[Hook] %s panic: %v", name, r)
+		}
+	}()
+	hook()
+}
+
+func (c *Crawler) onRequest(link *Link) {
+	if hook := c.Hooks.OnRequest; hook != nil {
+		callHook("OnRequest", func() { hook(link) })
+	}
+}
+
+func (c *Crawler) onResponse(link *Link, response *network.Response) {
+	if hook := c.Hooks.OnResponse; hook != nil {
+		callHook("OnResponse", func() { hook(link, response) })
+	}
+}
+
+func (c *Crawler) onError(link *Link, e error) {
+	if hook := c.Hooks.OnError; hook != nil {
+		callHook("OnError", func() { hook(link, e) })
+	}
+}
+
+func (c *Crawler) onLinkDiscovered(parent *Link, link *Link) {
+	if hook := c.Hooks.OnLinkDiscovered; hook != nil {
+		callHook("OnLinkDiscovered", func() { hook(parent, link) })
+	}
+}
+
+func (c *Crawler) onDuplicate(link *Link) {
+	if hook := c.Hooks.OnDuplicate; hook != nil {
+		callHook("OnDuplicate", func() { hook(link) })
+	}
+}
+
+func (c *Crawler) onIdle() {
+	if hook := c.Hooks.OnIdle; hook != nil {
+		callHook("OnIdle", hook)
+	}
+}
+
+func (c *Crawler) onFinish() {
+	if hook := c.Hooks.OnFinish; hook != nil {
+		stats := c.Stats()
+		callHook("OnFinish", func() { hook(stats) })
+	}
+}
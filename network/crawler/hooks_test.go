@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"cake/network"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCrawler_Hooks(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/b", "/c", "/missing"},
+		"/b": {"/"},
+		"/c": {},
+	})
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.MaxRetries = 0
+	var requests, responses, notFound, notFoundResponses, discovered, duplicates, idles int64
+	var finished *Stats
+	var lock sync.Mutex
+	parents := make(map[string]string)
+	c.Hooks = Hooks{
+		OnRequest:  func(link *Link) { atomic.AddInt64(&requests, 1) },
+		OnResponse: func(link *Link, response *network.Response) {
+			atomic.AddInt64(&responses, 1)
+			if response.StatusCode == http.StatusNotFound && response.Header != nil {
+				atomic.AddInt64(&notFoundResponses, 1)
+			}
+		},
+		OnError: func(link *Link, e error) { //non 200 status comes as error
+			var statusError *network.StatusError
+			if errors.As(e, &statusError) && statusError.StatusCode == http.StatusNotFound {
+				atomic.AddInt64(&notFound, 1)
+			}
+		},
+		OnLinkDiscovered: func(parent *Link, link *Link) {
+			atomic.AddInt64(&discovered, 1)
+			lock.Lock()
+			parents[link.Url] = parent.Url
+			lock.Unlock()
+		},
+		OnDuplicate: func(link *Link) { atomic.AddInt64(&duplicates, 1) },
+		OnIdle:      func() { atomic.AddInt64(&idles, 1) },
+		OnFinish:    func(stats *Stats) { finished = stats },
+	}
+	c.Start()
+	if requests != 5 || responses != 5 || notFound != 1 || notFoundResponses != 1 || discovered != 6 || duplicates != 2 || idles != 1 {
+		t.Errorf("wrong hook calls: request %d response %d not found %d/%d discovered %d duplicate %d idle %d",
+			requests, responses, notFound, notFoundResponses, discovered, duplicates, idles)
+	}
+	if parents[site.server.URL+"/c"] != site.server.URL+"/a" {
+		t.Errorf("wrong parent of /c: %s", parents[site.server.URL+"/c"])
+	}
+	if finished == nil || finished.Fetched != 4 || finished.StopReason != StopReasonFinished {
+		t.Errorf("wrong stats on finish: %+v", finished)
+	}
+}
+
+func TestCrawler_HookStop(t *testing.T) {
+	var served int64
+	site := createInfiniteSite(&served)
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/0")
+	c.WaitTime = time.Nanosecond
+	var once sync.Once
+	c.Hooks.OnResponse = func(link *Link, response *network.Response) {
+		if link.Depth >= 3 {
+			//Stop waits for workers, hook runs in one of them
+			once.Do(func() { go func() { _ = c.Stop(context.Background()) }() })
+		}
+	}
+	c.Hooks.OnRequest = func(link *Link) {
+		panic("broken hook")
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Start()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawler not stopped by hook")
+	}
+	if c.StopReason() != StopReasonStopped {
+		t.Errorf("wrong stop reason: %s", c.StopReason())
+	}
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"sync/atomic"
+)
+
+//why crawler stopped
+const (
+	StopReasonFinished    = "finished"     //no link left to fetch
+	StopReasonStopped     = "stopped"      //Stop was called
+	StopReasonMaxPages    = "max pages"    //MaxPages fetched
+	StopReasonMaxFailures = "max failures" //MaxFailures failed
+	StopReasonMaxDuration = "max duration" //ran MaxDuration
+	StopReasonFatal       = "fatal"        //a link failed with FailureFatal
+)
+
+//begin to stop, first reason wins.
+//only Stop with DrainOnStop drains the frontier, limits stop at once
+func (c *Crawler) stopWith(reason string) {
+	c.stopLock.Lock()
+	defer c.stopLock.Unlock()
+	c.stop(reason)
+}
+
+//finish crawl if nothing is left. false if Enqueue queued links meanwhile
+func (c *Crawler) finishIdle() bool {
+	c.stopLock.Lock()
+	defer c.stopLock.Unlock()
+	if !c.isShutdown() && c.unfinished() != 0 {
+		return false
+	}
+	c.stop(StopReasonFinished)
+	return true
+}
+
+//must hold stopLock
+func (c *Crawler) stop(reason string) {
+	if c.isShutdown() {
+		return
+	}
+	c.stopReason = reason
+	if reason == StopReasonStopped && c.DrainOnStop {
+		atomic.StoreInt32(&c.draining, 1)
+	}
+	atomic.StoreInt32(&c.shutdown, 1)
+	if reason != StopReasonFinished {
+		logger.InfoF("Crawler stopping. Reason: %s", reason)
+	}
+	c.wake()
+}
+
+//why crawler stopped, "" if it is still running
+func (c *Crawler) StopReason() string {
+	c.stopLock.Lock()
+	defer c.stopLock.Unlock()
+	return c.stopReason
+}
+
+func (c *Crawler) isDraining() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+//check budgets after a result, stop if any is used up
+func (c *Crawler) checkLimits() {
+	if c.MaxPages > 0 && c.CurrentFetchedPages >= c.MaxPages {
+		c.stopWith(StopReasonMaxPages)
+	} else if c.MaxFailures > 0 && c.CurrentFailPages >= c.MaxFailures {
+		c.stopWith(StopReasonMaxFailures)
+	}
+}
+
+//fetching ones may succeed, don't send more than MaxPages needs
+func (c *Crawler) pageBudgetLeft() bool {
+	return c.MaxPages <= 0 || c.CurrentFetchedPages+c.inFlight < c.MaxPages
+}
+
+//link is deeper than MaxDepth, don't enqueue it
+func (c *Crawler) tooDeep(link *Link) bool {
+	return c.MaxDepth > 0 && link.Depth > c.MaxDepth
+}
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+//chain site: / -> /1 -> /2 ... -> /n
+func createChainSite(n int) *testSite {
+	pages := map[string][]string{"/": {"/1"}}
+	for i := 1; i < n; i++ {
+		pages["/"+strconv.Itoa(i)] = []string{"/" + strconv.Itoa(i+1)}
+	}
+	pages["/"+strconv.Itoa(n)] = nil
+	return createTestSite(pages)
+}
+
+func TestCrawler_MaxDepth(t *testing.T) {
+	site := createChainSite(10)
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.MaxDepth = 3
+	c.Start()
+	if c.CurrentFetchedPages != 4 {
+		t.Errorf("expected depth 0-3 fetched, got %d pages", c.CurrentFetchedPages)
+	}
+	if c.StopReason() != StopReasonFinished {
+		t.Errorf("wrong stop reason: %s", c.StopReason())
+	}
+}
+
+func TestCrawler_MaxPages(t *testing.T) {
+	pages := map[string][]string{"/": nil}
+	for i := 0; i < 30; i++ {
+		pages["/"] = append(pages["/"], "/"+strconv.Itoa(i))
+		pages["/"+strconv.Itoa(i)] = nil
+	}
+	site := createTestSite(pages)
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.MaxPages = 10
+	c.Start()
+	if c.CurrentFetchedPages != 10 {
+		t.Errorf("expected 10 pages got %d", c.CurrentFetchedPages)
+	}
+	if c.StopReason() != StopReasonMaxPages {
+		t.Errorf("wrong stop reason: %s", c.StopReason())
+	}
+}
+
+func TestCrawler_MaxDuration(t *testing.T) {
+	var served int64
+	site := createInfiniteSite(&served)
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/0")
+	c.WaitTime = time.Nanosecond
+	c.MaxDuration = 200 * time.Millisecond
+	start := time.Now()
+	c.Start()
+	if cost := time.Since(start); cost > 2*time.Second {
+		t.Errorf("crawler should stop in time, cost: %v", cost)
+	}
+	if c.StopReason() != StopReasonMaxDuration {
+		t.Errorf("wrong stop reason: %s", c.StopReason())
+	}
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+//Meta is typed context of a link, like data of a listing page needed by its detail pages.
+//values keep their go types in memory. a frontier saving links as json, like the default
+//SpillingFrontier, FileFrontier or checkpoint, gives back numbers as float64 and times as strings:
+//read values with the getters, they accept both. such a frontier needs values json can encode,
+//a link with other values is dropped when queued and counted in Stats.Dropped
+type Meta map[string]interface{}
+
+//value of key, nil if missing
+func (m Meta) Get(key string) interface{} {
+	return m[key]
+}
+
+func (m Meta) String(key string) (string, bool) {
+	value, ok := m[key].(string)
+	return value, ok
+}
+
+func (m Meta) Int(key string) (int, bool) {
+	switch value := m[key].(type) {
+	case int:
+		return value, true
+	case int64:
+		return int(value), true
+	case float64:
+		if value == float64(int(value)) {
+			return int(value), true
+		}
+	}
+	return 0, false
+}
+
+func (m Meta) Float(key string) (float64, bool) {
+	switch value := m[key].(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+func (m Meta) Bool(key string) (bool, bool) {
+	value, ok := m[key].(bool)
+	return value, ok
+}
+
+func (m Meta) Time(key string) (time.Time, bool) {
+	switch value := m[key].(type) {
+	case time.Time:
+		return value, true
+	case string:
+		if t, e := time.Parse(time.RFC3339Nano, value); e == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+//shallow copy, for a child link to change without touching its parent
+func (m Meta) Clone() Meta {
+	if m == nil {
+		return nil
+	}
+	clone := make(Meta, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+//frontier saves links as json, implemented by frontiers of this package
+type savingFrontier interface {
+	savesLinks()
+}
+
+//meta of link can be queued: json must encode it if frontier saves links
+func (c *Crawler) checkMeta(link *Link) error {
+	if _, ok := c.frontier.(savingFrontier); !ok || link.Meta == nil {
+		return nil
+	}
+	if _, e := json.Marshal(link.Meta); e != nil {
+		return fmt.Errorf("meta can't be saved as json: %v", e)
+	}
+	return nil
+}
+
+//link can't be queued, counted in Stats.Dropped
+func (c *Crawler) dropLink(link *Link, e error) {
+	logger.ErrorF("url: %s can't be queued. Error: %v. Dropped!", link.Url, e)
+	atomic.AddInt64(&c.droppedLinks, 1)
+}
+
+//set meta value, Meta is created when nil. see Meta for values a frontier can save
+func (l *Link) SetMeta(key string, value interface{}) {
+	if l.Meta == nil {
+		l.Meta = make(Meta)
+	}
+	l.Meta[key] = value
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"cake/util/datastruct"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMeta_Json(t *testing.T) {
+	found := time.Date(2020, 5, 1, 8, 0, 0, 0, time.UTC)
+	link := &Link{Url: "https://example.com/a", AttrMap: map[string]string{"title": "a"}}
+	link.SetMeta("page", 2)
+	link.SetMeta("price", 9.5)
+	link.SetMeta("hot", true)
+	link.SetMeta("category", "books")
+	link.SetMeta("found", found)
+	content, e := json.Marshal(link)
+	if e != nil {
+		t.Fatal(e)
+	}
+	loaded := &Link{}
+	if e := json.Unmarshal(content, loaded); e != nil {
+		t.Fatal(e)
+	}
+	for _, meta := range []Meta{link.Meta, loaded.Meta} {
+		if page, ok := meta.Int("page"); !ok || page != 2 {
+			t.Errorf("wrong page: %v", meta.Get("page"))
+		}
+		if price, ok := meta.Float("price"); !ok || price != 9.5 {
+			t.Errorf("wrong price: %v", meta.Get("price"))
+		}
+		if hot, ok := meta.Bool("hot"); !ok || !hot {
+			t.Errorf("wrong hot: %v", meta.Get("hot"))
+		}
+		if category, ok := meta.String("category"); !ok || category != "books" {
+			t.Errorf("wrong category: %v", meta.Get("category"))
+		}
+		if when, ok := meta.Time("found"); !ok || !when.Equal(found) {
+			t.Errorf("wrong found: %v", meta.Get("found"))
+		}
+		if _, ok := meta.Int("price"); ok {
+			t.Errorf("9.5 is not an int")
+		}
+	}
+	if loaded.AttrMap["title"] != "a" {
+		t.Errorf("AttrMap should be kept: %v", loaded.AttrMap)
+	}
+	var empty Meta
+	if _, ok := empty.String("missing"); ok || empty.Clone() != nil {
+		t.Errorf("nil meta should be empty")
+	}
+}
+
+//listing page passes its category to detail pages by meta
+type metaProcessor struct {
+	site    *testSite
+	details map[string]*Link
+	lock    sync.Mutex
+}
+
+func (p *metaProcessor) Process(link *Link, html string) []*Link {
+	links := p.site.Process(link, html)
+	if link.Depth == 0 {
+		link.SetMeta("processed", true) //meta of crawled seed, not of caller's one
+		for _, child := range links {
+			child.Meta = link.Meta.Clone()
+			child.SetMeta("listing", link.Url)
+		}
+		if link.Url != p.site.server.URL+"/list" {
+			return links
+		}
+		bad := &Link{Url: p.site.server.URL + "/c"}
+		bad.SetMeta("done", make(chan bool)) //not json, spilling frontier can't save it
+		return append(links, bad)
+	}
+	p.lock.Lock()
+	p.details[link.Url] = link
+	p.lock.Unlock()
+	return links
+}
+
+func TestCrawler_LinkMeta(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":     {},
+		"/list": {"/a", "/b"},
+		"/a":    {},
+		"/b":    {},
+		"/c":    {},
+	})
+	defer site.server.Close()
+	processor := &metaProcessor{site: site, details: make(map[string]*Link)}
+	seed := &Link{Url: site.server.URL + "/list"}
+	seed.SetMeta("category", "books")
+	seed.SetMeta("page", 2)
+	c := CreateCrawler(processor, site, site.server.URL+"/")
+	c.AddSeeds(seed)
+	c.WaitTime = 0
+	start := time.Now()
+	c.Start()
+	if len(processor.details) != 2 {
+		t.Fatalf("expected 2 detail pages, got %d", len(processor.details))
+	}
+	for url, link := range processor.details {
+		category, _ := link.Meta.String("category")
+		listing, _ := link.Meta.String("listing")
+		if category != "books" || listing != site.server.URL+"/list" {
+			t.Errorf("wrong meta of %s: %v", url, link.Meta)
+		}
+		if page, ok := link.Meta.Get("page").(int); !ok || page != 2 { //not spilled, go type is kept
+			t.Errorf("meta of %s should keep its type: %T", url, link.Meta.Get("page"))
+		}
+		if link.Parent != site.server.URL+"/list" || link.Depth != 1 || link.DiscoveredAt.Before(start) {
+			t.Errorf("wrong link info of %s: %+v", url, link)
+		}
+	}
+	if _, ok := seed.Meta.Bool("processed"); ok || len(seed.Meta) != 2 || seed.Meta.Get("page") != 2 {
+		t.Errorf("meta of seed should not change: %v", seed.Meta)
+	}
+	for _, visited := range site.visited {
+		if visited == site.server.URL+"/c" {
+			t.Errorf("link with bad meta should be dropped")
+		}
+	}
+	if stats := c.Stats(); stats.Dropped != 1 {
+		t.Errorf("dropped link should be counted: %+v", stats)
+	}
+}
+
+func TestCrawler_SeedMeta(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": {}})
+	defer site.server.Close()
+	seed := &Link{Url: site.server.URL + "/"}
+	seed.SetMeta("done", func() {})
+	c := CreateCrawlerWithSeeds(site, site, []*Link{seed}, &CrawlerOptions{WaitTime: NoWait})
+	c.Start()
+	if c.CurrentFetchedPages != 0 || len(site.visited) != 0 || c.Stats().Dropped != 1 {
+		t.Errorf("seed with bad meta should be dropped: %v", site.visited)
+	}
+	//memory frontier never saves links, any value is kept
+	site.urlPool = datastruct.CreateHashSet("test-site")
+	c = CreateCrawlerWithSeeds(site, site, []*Link{seed}, &CrawlerOptions{WaitTime: NoWait})
+	c.SetFrontier(CreateMemoryFrontier())
+	c.Start()
+	if c.CurrentFetchedPages != 1 || c.Stats().Dropped != 0 {
+		t.Errorf("memory frontier should queue any meta: %d", c.CurrentFetchedPages)
+	}
+}
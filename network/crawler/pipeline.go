@@ -0,0 +1,171 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//Item is structured data extracted from a page: field name -> value
+type Item map[string]interface{}
+
+//ItemProcessor is a Processor that also returns items, crawler sends them to its Pipeline
+type ItemProcessor interface {
+	Processor
+	//process result and return items and links, error works like ErrorProcessor
+	ProcessItems(link *Link, html string) ([]Item, []*Link, error)
+}
+
+//Stage is one step of Pipeline: validate, transform, dedupe or store items
+type Stage interface {
+	//return item for next stage, nil item to drop it.
+	//error drops the item and is reported
+	ProcessItem(link *Link, item Item) (Item, error)
+}
+
+//function as a Stage, like a transform
+type StageFunc func(link *Link, item Item) (Item, error)
+
+func (f StageFunc) ProcessItem(link *Link, item Item) (Item, error) {
+	return f(link, item)
+}
+
+//PipelineMetrics counts items of Pipeline
+type PipelineMetrics struct {
+	Items   int64 //items pushed
+	Passed  int64 //items passed all stages
+	Dropped int64 //items dropped by a stage
+	Errors  int64 //items dropped by error
+}
+
+//Pipeline sends items through stages in order, one item at a time
+//so stages don't need to be thread safe. stages implement io.Closer are closed with it
+type Pipeline struct {
+	stages  []Stage
+	OnError func(link *Link, item Item, e error) //called when a stage fails, nil only logs
+	metrics PipelineMetrics
+	lock    sync.Mutex
+}
+
+func CreatePipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+//add stage to the end
+func (p *Pipeline) Add(stage Stage) *Pipeline {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+//run item through stages, false if it was dropped
+func (p *Pipeline) Push(link *Link, item Item) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.metrics.Items += 1
+	for i, stage := range p.stages {
+		next, e := stage.ProcessItem(link, item)
+		if e != nil {
+			p.metrics.Errors += 1
+			e = fmt.Errorf("[Pipeline] Stage: %d Url: %s Error: %v", i, link.Url, e)
+			if p.OnError != nil {
+				p.OnError(link, item, e)
+			} else {
+				logger.ErrorF("%v", e)
+			}
+			return false
+		}
+		if next == nil {
+			p.metrics.Dropped += 1
+			return false
+		}
+		item = next
+	}
+	p.metrics.Passed += 1
+	return true
+}
+
+func (p *Pipeline) Metrics() *PipelineMetrics {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	metrics := p.metrics
+	return &metrics
+}
+
+//close stages which can be closed, like writers
+func (p *Pipeline) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var lastError error
+	for _, stage := range p.stages {
+		if closer, ok := stage.(interface{ Close() error }); ok {
+			if e := closer.Close(); e != nil {
+				logger.WarnF("[Pipeline] Close stage Error: %v", e)
+				lastError = e
+			}
+		}
+	}
+	return lastError
+}
+
+//drop items missing any of required fields or having them empty
+func ValidateStage(required ...string) Stage {
+	return StageFunc(func(link *Link, item Item) (Item, error) {
+		for _, field := range required {
+			if value, ok := item[field]; !ok || value == nil || value == "" {
+				logger.DebugF("[Pipeline] Item of: %s has no field: %s. Drop!", link.Url, field)
+				return nil, nil
+			}
+		}
+		return item, nil
+	})
+}
+
+//drop items seen before, items are the same when values of fields are equal
+//no fields compares all fields
+func DedupeStage(fields ...string) Stage {
+	seen := make(map[string]bool) //pipeline calls stages one by one, no lock needed
+	return StageFunc(func(link *Link, item Item) (Item, error) {
+		keyFields := fields
+		if len(keyFields) == 0 {
+			keyFields = sortedFields(item)
+		}
+		var key strings.Builder
+		for _, field := range keyFields {
+			key.WriteString(field + "=" + fmt.Sprint(item[field]) + "\x00")
+		}
+		if seen[key.String()] {
+			return nil, nil
+		}
+		seen[key.String()] = true
+		return item, nil
+	})
+}
+
+//crawler sends items of ItemProcessor to pipeline, nil to discard items
+//must be called before Start. pipeline is closed when crawler finished
+func (c *Crawler) SetPipeline(pipeline *Pipeline) {
+	c.pipeline = pipeline
+}
+
+//items and links of page
+func (c *Crawler) process(link *Link, html string) ([]*Link, error) {
+	switch processor := c.processor.(type) {
+	case ItemProcessor:
+		items, links, e := processor.ProcessItems(link, html)
+		if e != nil {
+			return nil, e
+		}
+		if c.pipeline != nil {
+			for _, item := range items {
+				c.pipeline.Push(link, item)
+			}
+		}
+		return links, nil
+	case ErrorProcessor:
+		return processor.ProcessWithError(link, html)
+	default:
+		return c.processor.Process(link, html), nil
+	}
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	link := &Link{Url: "http://example.com/"}
+	var stored []Item
+	var failures []error
+	p := CreatePipeline(
+		ValidateStage("title"),
+		StageFunc(func(link *Link, item Item) (Item, error) {
+			if item["title"] == "bad" {
+				return nil, fmt.Errorf("bad title")
+			}
+			item["title"] = strings.ToUpper(item["title"].(string))
+			return item, nil
+		}),
+		DedupeStage("title"),
+	).Add(StageFunc(func(link *Link, item Item) (Item, error) {
+		stored = append(stored, item)
+		return item, nil
+	}))
+	p.OnError = func(link *Link, item Item, e error) {
+		failures = append(failures, e)
+	}
+	items := []Item{
+		{"title": "a", "n": 1},
+		{"title": ""},
+		{"n": 2},
+		{"title": "bad"},
+		{"title": "A", "n": 3}, //same as first after transform
+		{"title": "b"},
+	}
+	for _, item := range items {
+		p.Push(link, item)
+	}
+	if len(stored) != 2 || stored[0]["title"] != "A" || stored[1]["title"] != "B" {
+		t.Errorf("wrong stored items: %v", stored)
+	}
+	metrics := p.Metrics()
+	if metrics.Items != 6 || metrics.Passed != 2 || metrics.Dropped != 3 || metrics.Errors != 1 {
+		t.Errorf("wrong metrics: %+v", metrics)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0].Error(), "bad title") {
+		t.Errorf("error not reported: %v", failures)
+	}
+}
+
+func TestDedupeStage_AllFields(t *testing.T) {
+	p := CreatePipeline(DedupeStage())
+	link := &Link{Url: "http://example.com/"}
+	p.Push(link, Item{"a": "1", "b": "2"})
+	p.Push(link, Item{"b": "2", "a": "1"})
+	p.Push(link, Item{"a": "1", "b": "3"})
+	if metrics := p.Metrics(); metrics.Passed != 2 || metrics.Dropped != 1 {
+		t.Errorf("wrong metrics: %+v", metrics)
+	}
+}
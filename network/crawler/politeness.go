@@ -0,0 +1,179 @@
+package crawler
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+//links held back by politeness at most, then frontier is not popped until a host is ready
+const maxHeldLinks = 1000
+
+//keeps a delay between requests of the same host. fetch loop holds links of a host
+//until its delay is over and dispatches links of other hosts meanwhile, workers never sleep.
+//fetch loop holds, reserves and dispatches, workers report Crawl-delay of hosts
+type politeness struct {
+	hostDelay time.Duration            //min delay of every host
+	learn     bool                     //robots enabled: delay of a host is unknown until its robots.txt is read
+	next      map[string]time.Time     //host -> earliest time of next request
+	started   map[string]time.Time     //host -> time of last request
+	unknown   map[string]bool          //host waits for its robots.txt, no request until learned
+	delays    map[string]time.Duration //host -> Crawl-delay
+	held      map[string][]*Link       //links waiting for their host, in pop order
+	heldLinks int
+	lock      sync.Mutex
+}
+
+func createPoliteness() *politeness {
+	return &politeness{
+		next:    make(map[string]time.Time),
+		started: make(map[string]time.Time),
+		unknown: make(map[string]bool),
+		delays:  make(map[string]time.Duration),
+		held:    make(map[string][]*Link),
+	}
+}
+
+//set before crawl: HostDelay and whether Crawl-delay comes from robots.txt
+func (p *politeness) setup(hostDelay time.Duration, learn bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.hostDelay = hostDelay
+	p.learn = learn
+}
+
+func (p *politeness) enabled() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.hostDelay > 0 || p.learn
+}
+
+func hostOf(link *Link) string {
+	if u, e := url.Parse(link.Url); e == nil {
+		return u.Host
+	}
+	return ""
+}
+
+//host is not in its delay and not waiting for robots.txt. must hold lock
+func (p *politeness) ready(host string, now time.Time) bool {
+	return host == "" || (!p.unknown[host] && !now.Before(p.next[host]))
+}
+
+//hold link if its host is not ready or has links held before it. false means dispatch it now
+func (p *politeness) hold(link *Link) bool {
+	host := hostOf(link)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.held[host]) == 0 && p.ready(host, time.Now()) {
+		return false
+	}
+	p.held[host] = append(p.held[host], link)
+	p.heldLinks += 1
+	return true
+}
+
+//a held link whose host is ready, nil if none
+func (p *politeness) due() *Link {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	for host, links := range p.held {
+		if !p.ready(host, now) {
+			continue
+		}
+		link := links[0]
+		if len(links) == 1 {
+			delete(p.held, host)
+		} else {
+			p.held[host] = links[1:]
+		}
+		p.heldLinks -= 1
+		return link
+	}
+	return nil
+}
+
+//time until the earliest host with held links is ready, false if there is none.
+//hosts waiting for robots.txt are skipped, worker wakes fetch loop when it is read
+func (p *politeness) wait() (time.Duration, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var earliest time.Time
+	for host := range p.held {
+		if p.unknown[host] {
+			continue
+		}
+		if next := p.next[host]; earliest.IsZero() || next.Before(earliest) {
+			earliest = next
+		}
+	}
+	if earliest.IsZero() {
+		return 0, false
+	}
+	return time.Until(earliest), true
+}
+
+//link is dispatched now, next request of its host waits for the delay
+func (p *politeness) reserve(link *Link) {
+	host := hostOf(link)
+	if host == "" {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	p.started[host] = now
+	delay, known := p.delays[host]
+	if p.learn && !known {
+		p.unknown[host] = true
+		return
+	}
+	p.next[host] = now.Add(p.delayOf(delay))
+}
+
+//worker read Crawl-delay of host from robots.txt. true if host was waiting for it
+func (p *politeness) learned(host string, crawlDelay time.Duration) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.delays[host] = crawlDelay
+	if !p.unknown[host] {
+		return false
+	}
+	delete(p.unknown, host)
+	p.next[host] = p.started[host].Add(p.delayOf(crawlDelay))
+	return true
+}
+
+//HostDelay or Crawl-delay, the longer one. must hold lock
+func (p *politeness) delayOf(crawlDelay time.Duration) time.Duration {
+	if crawlDelay > p.hostDelay {
+		return crawlDelay
+	}
+	return p.hostDelay
+}
+
+//links held back now
+func (p *politeness) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.heldLinks
+}
+
+//next link to dispatch. links of a host still in its delay are held back
+//and links of other hosts go first
+func (c *Crawler) readyLink() *Link {
+	if !c.politeness.enabled() {
+		return c.nextLink()
+	}
+	if link := c.politeness.due(); link != nil {
+		return link
+	}
+	for c.politeness.Len() < maxHeldLinks {
+		link := c.nextLink()
+		if link == nil || !c.politeness.hold(link) {
+			return link
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"container/heap"
+	"net/url"
+	"sync"
+)
+
+//item of priority heap, seq keeps FIFO order of same priority
+type priorityItem struct {
+	link *Link
+	seq  uint64
+}
+
+//max heap by Link.Priority, then by push order
+type priorityHeap []*priorityItem
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].link.Priority != h[j].link.Priority {
+		return h[i].link.Priority > h[j].link.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(*priorityItem)) }
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+//PriorityFrontier pops link of highest Link.Priority first, FIFO for the same priority
+//with host fairness every host has its own queue and hosts take turns,
+//so one domain with many high priority links can't starve the others
+type PriorityFrontier struct {
+	fair   bool
+	queues map[string]*priorityHeap //host -> links, "" holds all when not fair
+	hosts  []string                 //hosts have links, in turn order
+	turn   int                      //index of next host in hosts
+	length int
+	seq    uint64
+	lock   sync.Mutex
+}
+
+func CreatePriorityFrontier(fairHosts bool) *PriorityFrontier {
+	return &PriorityFrontier{fair: fairHosts, queues: make(map[string]*priorityHeap)}
+}
+
+func (f *PriorityFrontier) hostOf(link *Link) string {
+	if !f.fair {
+		return ""
+	}
+	if target, e := url.Parse(link.Url); e == nil {
+		return target.Host
+	}
+	return ""
+}
+
+func (f *PriorityFrontier) Push(link *Link) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	host := f.hostOf(link)
+	queue, ok := f.queues[host]
+	if !ok {
+		queue = &priorityHeap{}
+		f.queues[host] = queue
+		f.hosts = append(f.hosts, host)
+	}
+	heap.Push(queue, &priorityItem{link: link, seq: f.seq})
+	f.seq += 1
+	f.length += 1
+	return nil
+}
+
+func (f *PriorityFrontier) Pop() (*Link, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.length == 0 {
+		return nil, nil
+	}
+	if f.turn >= len(f.hosts) {
+		f.turn = 0
+	}
+	host := f.hosts[f.turn]
+	queue := f.queues[host]
+	item := heap.Pop(queue).(*priorityItem)
+	f.length -= 1
+	if queue.Len() == 0 { //host has nothing left, next host takes its index
+		delete(f.queues, host)
+		f.hosts = append(f.hosts[:f.turn], f.hosts[f.turn+1:]...)
+	} else {
+		f.turn += 1
+	}
+	return item.link, nil
+}
+
+func (f *PriorityFrontier) Done(link *Link) error {
+	return nil
+}
+
+func (f *PriorityFrontier) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.length
+}
+
+func (f *PriorityFrontier) Close() error {
+	return nil
+}
+
+//set Priority of link by PriorityFunc
+func (c *Crawler) prioritize(link *Link) {
+	if c.PriorityFunc != nil {
+		link.Priority = c.PriorityFunc(link)
+	}
+}
@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func popUrls(t *testing.T, f Frontier) []string {
+	var urls []string
+	for {
+		link, e := f.Pop()
+		if e != nil {
+			t.Fatal(e)
+		}
+		if link == nil {
+			return urls
+		}
+		urls = append(urls, link.Url)
+	}
+}
+
+func TestPriorityFrontier(t *testing.T) {
+	f := CreatePriorityFrontier(false)
+	_ = f.Push(&Link{Url: "http://a.com/low1", Priority: 1})
+	_ = f.Push(&Link{Url: "http://a.com/high", Priority: 5})
+	_ = f.Push(&Link{Url: "http://a.com/low2", Priority: 1})
+	_ = f.Push(&Link{Url: "http://b.com/mid", Priority: 3})
+	if f.Len() != 4 {
+		t.Errorf("expected 4 links got %d", f.Len())
+	}
+	urls := strings.Join(popUrls(t, f), " ")
+	expected := "http://a.com/high http://b.com/mid http://a.com/low1 http://a.com/low2"
+	if urls != expected {
+		t.Errorf("wrong order: %s", urls)
+	}
+}
+
+func TestPriorityFrontier_Fair(t *testing.T) {
+	f := CreatePriorityFrontier(true)
+	for i := 0; i < 3; i++ {
+		_ = f.Push(&Link{Url: "http://a.com/" + strconv.Itoa(i), Priority: 10 - i})
+	}
+	_ = f.Push(&Link{Url: "http://b.com/0"})
+	_ = f.Push(&Link{Url: "http://c.com/0"})
+	urls := strings.Join(popUrls(t, f), " ")
+	expected := "http://a.com/0 http://b.com/0 http://c.com/0 http://a.com/1 http://a.com/2"
+	if urls != expected {
+		t.Errorf("wrong order: %s", urls)
+	}
+	if f.Len() != 0 {
+		t.Errorf("frontier should be empty")
+	}
+}
+
+func TestCrawler_PriorityFunc(t *testing.T) {
+	//list pages link to details and next list page
+	pages := map[string][]string{}
+	for i := 0; i < 3; i++ {
+		list := "/list/" + strconv.Itoa(i)
+		pages[list] = []string{"/list/" + strconv.Itoa(i+1)}
+		for j := 0; j < 2; j++ {
+			detail := "/detail/" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
+			pages[list] = append(pages[list], detail)
+			pages[detail] = nil
+		}
+	}
+	pages["/list/3"] = nil
+	site := createTestSite(pages)
+	defer site.server.Close()
+	c := CreateCrawlerByOptions(site, site, site.server.URL+"/list/0", &CrawlerOptions{
+		Workers:  1,
+		WaitTime: NoWait,
+	})
+	c.SetFrontier(CreatePriorityFrontier(false))
+	c.PriorityFunc = func(link *Link) int {
+		if strings.Contains(link.Url, "/detail/") {
+			return 1
+		}
+		return 0
+	}
+	c.Start()
+	if c.CurrentFetchedPages != 10 {
+		t.Fatalf("expected 10 pages got %d", c.CurrentFetchedPages)
+	}
+	//details of a list page are fetched before next list page
+	for i, url := range site.visited {
+		if strings.Contains(url, "/list/") && i > 0 && strings.Contains(site.visited[i-1], "/list/") {
+			t.Errorf("list pages fetched one after another: %v", site.visited)
+			break
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"cake/network"
+	"container/heap"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//delay before the first retry of a failed link, doubled for every next attempt.
+//two retry layers compound: every crawler attempt runs the engine's own retries,
+//network.Retries requests 1s apart, so a link may be requested Retries*(MaxRetries+1) times
+//and a dead host keeps crawl alive about RetryDelay*(2^MaxRetries-1) longer, 7 minutes by default
+const DefaultRetryDelay = time.Minute
+
+//failed link waiting for its retry time
+type delayedLink struct {
+	link     *Link
+	original *Link //failed link, pending in frontier until retry is pushed so checkpoint keeps it
+	due      time.Time
+}
+
+//min heap by due time
+type delayedHeap []*delayedLink
+
+func (h delayedHeap) Len() int { return len(h) }
+
+func (h delayedHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+
+func (h delayedHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *delayedHeap) Push(x interface{}) { *h = append(*h, x.(*delayedLink)) }
+
+func (h *delayedHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+//failed links go back to frontier when their delay is over
+//workers add links, fetch loop moves due ones to frontier
+type retryQueue struct {
+	links delayedHeap
+	lock  sync.Mutex
+}
+
+func (q *retryQueue) add(link *Link, original *Link, delay time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	heap.Push(&q.links, &delayedLink{link: link, original: original, due: time.Now().Add(delay)})
+}
+
+//time until the earliest retry, false if nothing waits
+func (q *retryQueue) wait() (time.Duration, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.links) == 0 {
+		return 0, false
+	}
+	return time.Until(q.links[0].due), true
+}
+
+//take links due before now, all links if force
+func (q *retryQueue) take(force bool) []*delayedLink {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	var links []*delayedLink
+	now := time.Now()
+	for len(q.links) > 0 && (force || !q.links[0].due.After(now)) {
+		links = append(links, heap.Pop(&q.links).(*delayedLink))
+	}
+	return links
+}
+
+func (q *retryQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.links)
+}
+
+//delay before next attempt: RetryDelay, 2*RetryDelay, 4*RetryDelay ...
+func (c *Crawler) retryDelay(attempts int) time.Duration {
+	delay := c.RetryDelay
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+//links left to finish crawl. after stop, links waiting for retry are not waited for,
+//they stay in retry queue and go to frontier for checkpoint when crawler exits
+func (c *Crawler) unfinished() int64 {
+	if !c.isShutdown() {
+		return atomic.LoadInt64(&c.pending)
+	}
+	waiting := int64(c.retries.Len()) //read before pending, so never less than the real number
+	return atomic.LoadInt64(&c.pending) - waiting
+}
+
+//move due retries to frontier, then failed links they replace are done.
+//when force, all of them are moved, used when crawler exits so a checkpoint keeps them
+func (c *Crawler) requeueRetries(force bool) {
+	for _, retry := range c.retries.take(force) {
+		if e := c.frontier.Push(retry.link); e != nil {
+			c.dropLink(retry.link, e)
+			atomic.AddInt64(&c.pending, -1)
+		}
+		if e := c.frontier.Done(retry.original); e != nil {
+			logger.WarnF("Frontier Done link: %s Error: %v", retry.original.Url, e)
+		}
+	}
+}
+
+//links failed to fetch: host outage and server errors are retried,
+//unknown hosts and other status codes are dropped
+func fetchFailure(e error) error {
+	var statusError *network.StatusError
+	if errors.As(e, &statusError) {
+		code := statusError.StatusCode
+		if code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests {
+			return DropError(e)
+		}
+	}
+	var dnsError *net.DNSError
+	if errors.As(e, &dnsError) && dnsError.IsNotFound {
+		return DropError(e)
+	}
+	return RetryLaterError(e)
+}
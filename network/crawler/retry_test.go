@@ -0,0 +1,181 @@
+package crawler
+
+import (
+	"cake/network"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryQueue(t *testing.T) {
+	q := &retryQueue{}
+	q.add(&Link{Url: "b"}, nil, time.Hour)
+	q.add(&Link{Url: "a"}, nil, 0)
+	if wait, ok := q.wait(); !ok || wait > 0 {
+		t.Errorf("first retry should be due: %v %v", wait, ok)
+	}
+	if links := q.take(false); len(links) != 1 || links[0].link.Url != "a" {
+		t.Errorf("only due link should be taken: %v", links)
+	}
+	if links := q.take(true); len(links) != 1 || q.Len() != 0 {
+		t.Errorf("force should take all: %v", links)
+	}
+}
+
+func TestFetchFailure(t *testing.T) {
+	cases := map[error]int{
+		&network.StatusError{StatusCode: http.StatusNotFound}:                 FailureDrop,
+		&network.StatusError{StatusCode: http.StatusTooManyRequests}:          FailureRetry,
+		&network.StatusError{StatusCode: http.StatusServiceUnavailable}:       FailureRetry,
+		&network.BreakerOpenError{Host: "a.com"}:                              FailureRetry,
+		fmt.Errorf("connection refused"):                                      FailureRetry,
+		fmt.Errorf("get: %w", &net.DNSError{Name: "a.com", IsNotFound: true}): FailureDrop,
+	}
+	for e, kind := range cases {
+		if FailureKind(fetchFailure(e)) != kind {
+			t.Errorf("error: %v expected kind: %d", e, kind)
+		}
+	}
+	c := &Crawler{RetryDelay: time.Second}
+	if c.retryDelay(1) != time.Second || c.retryDelay(3) != 4*time.Second {
+		t.Errorf("wrong retry delay: %v %v", c.retryDelay(1), c.retryDelay(3))
+	}
+}
+
+func TestCrawler_RetryOutage(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":     {"/down"},
+		"/down": {"/next"},
+		"/next": nil,
+	})
+	defer site.server.Close()
+	//host is down for the first requests of /down, engine retries are used up at once
+	var requests int32
+	handler := site.server.Config.Handler
+	site.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" && atomic.AddInt32(&requests, 1) <= 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.httpClient = network.CreateEngineByParams(network.MaxConnections, network.Timeout, 1)
+	c.WaitTime = time.Nanosecond
+	c.RetryDelay = 50 * time.Millisecond
+	c.Start()
+	if c.CurrentFetchedPages != 3 || c.CurrentFailPages != 0 || c.Stats().Retried != 1 {
+		t.Errorf("expected 3 fetched 0 fail 1 retry, got %d %d %d", c.CurrentFetchedPages, c.CurrentFailPages, c.Stats().Retried)
+	}
+}
+
+func TestCrawler_RetryLeftOnStop(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": {"/down"}})
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.httpClient = network.CreateEngineByParams(network.MaxConnections, network.Timeout, 1)
+	c.WaitTime = time.Nanosecond
+	c.RetryDelay = time.Hour
+	frontier := CreateMemoryFrontier()
+	c.SetFrontier(frontier)
+	c.ClassifyFailure = func(link *Link, e error) int { return FailureRetry }
+	handle, e := c.StartAsync()
+	if e != nil {
+		t.Fatal(e)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.retries.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e := c.Stop(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+	handle.Wait()
+	if frontier.Len() != 1 {
+		t.Errorf("waiting retry should be left in frontier, got %d links", frontier.Len())
+	}
+}
+
+func TestCrawler_RetryLeftOnDrain(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": {"/down"}})
+	defer site.server.Close()
+	var downServed int32
+	handler := site.server.Config.Handler
+	site.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			atomic.AddInt32(&downServed, 1)
+		}
+		handler.ServeHTTP(w, r)
+	})
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.httpClient = network.CreateEngineByParams(network.MaxConnections, network.Timeout, 1)
+	c.WaitTime = time.Nanosecond
+	c.RetryDelay = time.Hour
+	c.DrainOnStop = true
+	frontier := CreateMemoryFrontier()
+	c.SetFrontier(frontier)
+	c.ClassifyFailure = func(link *Link, e error) int { return FailureRetry }
+	handle, e := c.StartAsync()
+	if e != nil {
+		t.Fatal(e)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.retries.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e := c.Stop(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+	handle.Wait()
+	if n := atomic.LoadInt32(&downServed); n != 1 || frontier.Len() != 1 {
+		t.Errorf("drain should not fetch waiting retry: served %d times, %d links left", n, frontier.Len())
+	}
+}
+
+func TestCrawler_RetryCheckpoint(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": {"/down"}})
+	defer site.server.Close()
+	dir := t.TempDir()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.httpClient = network.CreateEngineByParams(network.MaxConnections, network.Timeout, 1)
+	c.WaitTime = time.Nanosecond
+	c.ClassifyFailure = func(link *Link, e error) int { return FailureRetry }
+	if e := c.EnableCheckpoint(dir, time.Hour); e != nil {
+		t.Fatal(e)
+	}
+	var failed *Link
+	c.Hooks.OnError = func(link *Link, e error) { failed = link }
+	handle, e := c.StartAsync()
+	if e != nil {
+		t.Fatal(e)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.retries.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	//crash while retry waits: what is on disk now is all a new run gets
+	if e := c.checkpoint.save(c.frontier); e != nil {
+		t.Fatal(e)
+	}
+	resumed := CreateCrawler(site, site, site.server.URL+"/")
+	if e := resumed.EnableCheckpoint(dir, time.Hour); e != nil {
+		t.Fatal(e)
+	}
+	if len(resumed.checkpoint.resumed) != 1 || resumed.checkpoint.resumed[0].link.Url != site.server.URL+"/down" {
+		t.Errorf("waiting retry should be in checkpoint: %v", resumed.checkpoint.resumed)
+	}
+	c.retries.lock.Lock()
+	retry := c.retries.links[0]
+	c.retries.lock.Unlock()
+	if retry.original != failed || retry.link == failed || retry.link.Attempts != 1 {
+		t.Errorf("retry should be a copy of failed link: %+v", retry)
+	}
+	if e := c.Stop(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+	handle.Wait()
+}
@@ -0,0 +1,305 @@
+package crawler
+
+import (
+	"cake/network"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//robots.txt of a host is fetched again after it
+const DefaultRobotsTTL = 24 * time.Hour
+
+//one Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string         //path pattern as written, its length decides priority
+	regexp  *regexp.Regexp //pattern with * and $ compiled
+}
+
+//RobotsRules are the rules of robots.txt for one user agent
+type RobotsRules struct {
+	rules      []*robotsRule
+	CrawlDelay time.Duration //0 if not specified
+	Sitemaps   []string      //Sitemap lines, they are not bound to user agent
+}
+
+//group of robots.txt: user agents and their rules
+type robotsGroup struct {
+	agents []string
+	rules  []*robotsRule
+	delay  time.Duration
+}
+
+//product token of user agent, "CakeBot/1.0 (+http://...)" -> "cakebot"
+func robotsToken(userAgent string) string {
+	token := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return strings.ToLower(token)
+}
+
+//compile path pattern: * matches any chars, $ at end anchors the end
+func compileRobotsPattern(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.Compile(expr)
+}
+
+//parse robots.txt and keep rules of the groups for userAgent
+//groups naming our product token win, otherwise "*" groups are used
+func ParseRobots(content string, userAgent string) *RobotsRules {
+	result := &RobotsRules{}
+	var groups []*robotsGroup
+	var current *robotsGroup
+	lastIsAgent := false //consecutive User-agent lines share one group
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+		switch key {
+		case "user-agent":
+			if current == nil || !lastIsAgent {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastIsAgent = true
+			continue
+		case "allow", "disallow":
+			if current == nil || value == "" { //empty Disallow allows all
+				break
+			}
+			compiled, e := compileRobotsPattern(value)
+			if e != nil {
+				logger.WarnF("[Robots] Bad pattern: %s Error: %v", value, e)
+				break
+			}
+			current.rules = append(current.rules, &robotsRule{allow: key == "allow", pattern: value, regexp: compiled})
+		case "crawl-delay":
+			if current == nil {
+				break
+			}
+			if seconds, e := strconv.ParseFloat(value, 64); e == nil && seconds >= 0 {
+				current.delay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			result.Sitemaps = append(result.Sitemaps, value)
+		}
+		lastIsAgent = false
+	}
+
+	token := robotsToken(userAgent)
+	matched := selectRobotsGroups(groups, func(agent string) bool { return token != "" && agent == token })
+	if len(matched) == 0 {
+		matched = selectRobotsGroups(groups, func(agent string) bool { return agent == "*" })
+	}
+	for _, group := range matched {
+		result.rules = append(result.rules, group.rules...)
+		if group.delay > result.CrawlDelay {
+			result.CrawlDelay = group.delay
+		}
+	}
+	return result
+}
+
+func selectRobotsGroups(groups []*robotsGroup, match func(agent string) bool) []*robotsGroup {
+	var selected []*robotsGroup
+	for _, group := range groups {
+		for _, agent := range group.agents {
+			if match(agent) {
+				selected = append(selected, group)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+//path with query can be fetched. longest matched pattern wins, Allow wins a tie
+func (r *RobotsRules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	var best *robotsRule
+	for _, rule := range r.rules {
+		if !rule.regexp.MatchString(path) {
+			continue
+		}
+		if best == nil || len(rule.pattern) > len(best.pattern) ||
+			(len(rule.pattern) == len(best.pattern) && rule.allow) {
+			best = rule
+		}
+	}
+	return best == nil || best.allow
+}
+
+//robots.txt of one host, ready is closed when fetched
+type robotsEntry struct {
+	ready    chan struct{}
+	content  string                  //robots.txt, "" allows all
+	parsed   map[string]*RobotsRules //product token -> its rules
+	lock     sync.Mutex              //guard parsed
+	e        error                   //robots.txt unreachable, links of host wait for next fetch
+	failures int   //fetches failed in a row
+	expire   time.Time
+}
+
+func (entry *robotsEntry) expired() bool {
+	select {
+	case <-entry.ready:
+		return time.Now().After(entry.expire)
+	default:
+		return false //still fetching
+	}
+}
+
+//rules of robots.txt for userAgent, parsed once per product token
+func (entry *robotsEntry) rulesOf(userAgent string) *RobotsRules {
+	token := robotsToken(userAgent)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+	rules, ok := entry.parsed[token]
+	if !ok {
+		rules = ParseRobots(entry.content, userAgent)
+		entry.parsed[token] = rules
+	}
+	return rules
+}
+
+//robots.txt per host, fetched once and cached for ttl
+type robotsCache struct {
+	engine    *network.HttpEngine
+	userAgent string //robots.txt is requested with it, page requests send it too
+	ttl       time.Duration
+	failDelay time.Duration //first delay after a failed fetch, RetryDelay of crawler
+	entries   map[string]*robotsEntry //scheme://host -> entry
+	lock      sync.Mutex
+}
+
+//rules of the host of target for userAgent. the first caller fetches, others wait for it
+//error when robots.txt can't be reached, it is fetched again after a short delay
+func (r *robotsCache) rules(target *url.URL, userAgent string) (*RobotsRules, error) {
+	key := target.Scheme + "://" + target.Host
+	r.lock.Lock()
+	entry, ok := r.entries[key]
+	if ok && !entry.expired() {
+		r.lock.Unlock()
+		<-entry.ready
+		if entry.e != nil {
+			return nil, entry.e
+		}
+		return entry.rulesOf(userAgent), nil
+	}
+	failures := 0
+	if ok {
+		failures = entry.failures
+	}
+	entry = &robotsEntry{ready: make(chan struct{}), parsed: make(map[string]*RobotsRules)}
+	r.entries[key] = entry
+	r.lock.Unlock()
+
+	entry.content, entry.e = r.fetch(key + "/robots.txt")
+	if entry.e != nil {
+		entry.failures = failures + 1
+		entry.expire = time.Now().Add(r.failureDelay(entry.failures))
+	} else {
+		entry.expire = time.Now().Add(r.ttl)
+	}
+	close(entry.ready)
+	if entry.e != nil {
+		return nil, entry.e
+	}
+	return entry.rulesOf(userAgent), nil
+}
+
+//failDelay, 2*failDelay ... up to ttl. same as delays of link retries,
+//so a link retried after robots.txt failed finds it expired and fetches it again
+func (r *robotsCache) failureDelay(failures int) time.Duration {
+	delay := r.failDelay
+	for i := 1; i < failures && delay < r.ttl; i++ {
+		delay *= 2
+	}
+	if delay > r.ttl {
+		delay = r.ttl
+	}
+	return delay
+}
+
+//content of robots.txt. missing one is "" and allows all, unreachable one is an error
+func (r *robotsCache) fetch(robotsUrl string) (string, error) {
+	response, e := r.engine.GetOnce(robotsUrl, map[string]string{"User-Agent": r.userAgent})
+	if e != nil {
+		return "", fmt.Errorf("[Robots] %s unreachable. Error: %v", robotsUrl, e)
+	}
+	switch {
+	case response.StatusCode == 429 || response.StatusCode >= 500:
+		return "", fmt.Errorf("[Robots] %s status: %d", robotsUrl, response.StatusCode)
+	case response.StatusCode >= 400:
+		return "", nil
+	case response.StatusCode >= 300: //redirects are followed by engine, more is given up
+		return "", nil
+	}
+	logger.DebugF("[Robots] %s -> %d bytes", robotsUrl, len(response.Body))
+	return string(response.Body), nil
+}
+
+//obey robots.txt of every host for userAgent, like "CakeBot/1.0"
+//pages are requested with userAgent too, it replaces SetUserAgentStrategy rotation
+//and the User-Agent of engine header profile, a warning is logged when they are set.
+//a link with its own User-Agent header is checked against rules of that agent.
+//ttl <= 0 uses DefaultRobotsTTL. must be called before Start.
+//when robots.txt is unreachable, links of its host are retried like failed fetches
+//and robots.txt is fetched again after RetryDelay, doubled on every failure up to ttl,
+//so every retry of a link fetches robots.txt again
+func (c *Crawler) EnableRobots(userAgent string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultRobotsTTL
+	}
+	c.robots = &robotsCache{
+		engine:    c.httpClient,
+		userAgent: userAgent,
+		ttl:       ttl,
+		entries:   make(map[string]*robotsEntry),
+	}
+}
+
+//set before crawl: failed robots.txt expires with retries of links
+func (r *robotsCache) setup(retryDelay time.Duration) {
+	r.failDelay = retryDelay
+}
+
+//robots.txt allows link for the userAgent it is sent with. delay is Crawl-delay of its host
+//error when robots.txt is unreachable, link should be retried later
+func (c *Crawler) robotsAllowed(target *url.URL, userAgent string) (bool, time.Duration, error) {
+	if c.robots == nil {
+		return true, 0, nil
+	}
+	rules, e := c.robots.rules(target, userAgent)
+	if e != nil {
+		return false, 0, e
+	}
+	return rules.Allowed(target.RequestURI()), rules.CrawlDelay, nil
+}
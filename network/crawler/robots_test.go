@@ -0,0 +1,284 @@
+package crawler
+
+import (
+	"cake/network"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func loadRobots(t *testing.T, userAgent string) *RobotsRules {
+	content, e := os.ReadFile("testdata/robots.txt")
+	if e != nil {
+		t.Fatal(e)
+	}
+	return ParseRobots(string(content), userAgent)
+}
+
+func TestParseRobots_Group(t *testing.T) {
+	rules := loadRobots(t, "CakeBot/1.0 (+http://example.com/bot)")
+	cases := map[string]bool{
+		"/":                   true,
+		"/private/a.html":     true, //only * group disallows it
+		"/cake-only/":         false,
+		"/cake-only/open":     true, //longer Allow wins
+		"/cake-only/openness": true,
+		"/search?q=go":        false,
+		"/search":             true,
+		"/robots.txt":         true,
+	}
+	for path, allowed := range cases {
+		if rules.Allowed(path) != allowed {
+			t.Errorf("path: %s expected allowed: %v", path, allowed)
+		}
+	}
+	if rules.CrawlDelay != 500*time.Millisecond {
+		t.Errorf("wrong crawl delay: %v", rules.CrawlDelay)
+	}
+	if len(rules.Sitemaps) != 2 || rules.Sitemaps[0] != "http://example.com/sitemap.xml" {
+		t.Errorf("wrong sitemaps: %v", rules.Sitemaps)
+	}
+}
+
+func TestParseRobots_Default(t *testing.T) {
+	rules := loadRobots(t, "UnknownBot/2.0")
+	cases := map[string]bool{
+		"/cake-only/":          true,
+		"/private/a.html":      false,
+		"/private/public.html": true,
+		"/doc/a.pdf":           false,
+		"/doc/a.pdf?download":  true, //$ anchors the end
+	}
+	for path, allowed := range cases {
+		if rules.Allowed(path) != allowed {
+			t.Errorf("path: %s expected allowed: %v", path, allowed)
+		}
+	}
+	if rules.CrawlDelay != 2*time.Second {
+		t.Errorf("wrong crawl delay: %v", rules.CrawlDelay)
+	}
+	if loadRobots(t, "BadBot").Allowed("/index.html") {
+		t.Errorf("BadBot should be disallowed")
+	}
+}
+
+func TestPoliteness_Hold(t *testing.T) {
+	p := createPoliteness()
+	p.setup(50*time.Millisecond, false)
+	first := &Link{Url: "http://a.com/1"}
+	if p.hold(first) {
+		t.Errorf("first link of a host should not be held")
+	}
+	p.reserve(first)
+	second, other := &Link{Url: "http://a.com/2"}, &Link{Url: "http://b.com/1"}
+	if !p.hold(second) || p.hold(other) || p.Len() != 1 {
+		t.Errorf("only link of a.com should be held, held: %d", p.Len())
+	}
+	if p.due() != nil {
+		t.Errorf("a.com is still in its delay")
+	}
+	wait, ok := p.wait()
+	if !ok || wait <= 0 || wait > 50*time.Millisecond {
+		t.Errorf("wrong wait: %v %v", wait, ok)
+	}
+	time.Sleep(wait)
+	if p.due() != second || p.Len() != 0 {
+		t.Errorf("held link should be due after delay")
+	}
+
+	//with robots, a host waits for its Crawl-delay before the second request
+	p = createPoliteness()
+	p.setup(0, true)
+	p.reserve(first)
+	if !p.hold(second) {
+		t.Errorf("host should wait for its robots.txt")
+	}
+	if _, ok := p.wait(); ok {
+		t.Errorf("host waiting for robots.txt has no due time")
+	}
+	if !p.learned("a.com", time.Hour) || p.due() != nil {
+		t.Errorf("Crawl-delay should hold link")
+	}
+}
+
+func TestCrawler_PolitenessOtherHosts(t *testing.T) {
+	slow := createTestSite(map[string][]string{"/": {"a", "b"}, "/a": nil, "/b": nil})
+	defer slow.server.Close()
+	handler := slow.server.Config.Handler
+	slow.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nCrawl-delay: 0.3\n"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	fast := createTestSite(map[string][]string{"/": {"a", "b", "c", "d"}, "/a": nil, "/b": nil, "/c": nil, "/d": nil})
+	defer fast.server.Close()
+	var lock sync.Mutex
+	var fastDone, slowDone time.Time
+	c := CreateCrawlerWithSeeds(&relativeProcessor{slow}, slow,
+		[]*Link{{Url: slow.server.URL + "/"}, {Url: fast.server.URL + "/"}}, &CrawlerOptions{Workers: 2, WaitTime: NoWait})
+	c.Hooks.OnResponse = func(link *Link, response *network.Response) {
+		lock.Lock()
+		defer lock.Unlock()
+		if strings.HasPrefix(link.Url, fast.server.URL) {
+			fastDone = time.Now()
+		} else {
+			slowDone = time.Now()
+		}
+	}
+	c.EnableRobots("CakeBot/1.0", 0)
+	start := time.Now()
+	c.Start()
+	if stats := c.Stats(); stats.Fetched != 8 {
+		t.Fatalf("expected 8 pages: %+v", stats)
+	}
+	if cost := slowDone.Sub(start); cost < 600*time.Millisecond {
+		t.Errorf("3 pages of slow host should take 2 delays, cost: %v", cost)
+	}
+	if cost := fastDone.Sub(start); cost > 300*time.Millisecond {
+		t.Errorf("fast host should not wait for slow one, cost: %v", cost)
+	}
+}
+
+func TestCrawler_Robots(t *testing.T) {
+	pages := map[string][]string{"/": nil}
+	for i := 0; i < 5; i++ {
+		pages["/"] = append(pages["/"], "/private/"+strconv.Itoa(i), "/public/"+strconv.Itoa(i))
+		pages["/private/"+strconv.Itoa(i)] = nil
+		pages["/public/"+strconv.Itoa(i)] = nil
+	}
+	site := createTestSite(pages)
+	defer site.server.Close()
+	var lock sync.Mutex
+	robotsFetched, privateServed := 0, 0
+	handler := site.server.Config.Handler
+	site.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		if strings.HasPrefix(r.URL.Path, "/private/") {
+			privateServed += 1
+		}
+		if r.URL.Path == "/robots.txt" {
+			robotsFetched += 1
+			lock.Unlock()
+			_, _ = w.Write([]byte("User-agent: cakebot\nDisallow: /private/\n"))
+			return
+		}
+		lock.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.EnableRobots("CakeBot/1.0", 0)
+	c.Start()
+	if c.CurrentFetchedPages != 6 || c.CurrentBlockedPages != 5 {
+		t.Errorf("expected 6 fetched 5 blocked, got %d %d", c.CurrentFetchedPages, c.CurrentBlockedPages)
+	}
+	if robotsFetched != 1 || privateServed != 0 {
+		t.Errorf("robots.txt fetched %d times, private served %d times", robotsFetched, privateServed)
+	}
+}
+
+func TestCrawler_RobotsMissing(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": {"/a"}, "/a": nil})
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.EnableRobots("CakeBot/1.0", time.Minute)
+	start := time.Now()
+	c.Start()
+	if c.CurrentFetchedPages != 2 || c.CurrentBlockedPages != 0 {
+		t.Errorf("missing robots.txt should allow all, got %d %d", c.CurrentFetchedPages, c.CurrentBlockedPages)
+	}
+	if cost := time.Since(start); cost > 2*time.Second {
+		t.Errorf("404 robots.txt should not be retried, cost: %v", cost)
+	}
+}
+
+func TestCrawler_RobotsUnreachable(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": {"/a"}, "/a": nil})
+	defer site.server.Close()
+	var robotsFetched int32
+	handler := site.server.Config.Handler
+	site.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			if atomic.AddInt32(&robotsFetched, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.RetryDelay = 100 * time.Millisecond
+	c.EnableRobots("CakeBot/1.0", 0)
+	c.Start()
+	stats := c.Stats()
+	if stats.Fetched != 2 || stats.Blocked != 0 || stats.Retried != 1 {
+		t.Errorf("link should wait for robots.txt, not be blocked: %+v", stats)
+	}
+	if n := atomic.LoadInt32(&robotsFetched); n < 2 {
+		t.Errorf("failed robots.txt should be fetched again, fetched %d times", n)
+	}
+}
+
+//with default delays every retry of a link comes after robots.txt failure expired
+func TestRobots_FailureDelay(t *testing.T) {
+	c := CreateCrawler(nil, nil, "")
+	c.EnableRobots("CakeBot/1.0", 0)
+	c.robots.setup(c.RetryDelay)
+	for attempts := 1; attempts <= c.MaxRetries; attempts++ {
+		if delay := c.robots.failureDelay(attempts); delay > c.retryDelay(attempts) {
+			t.Errorf("retry %d after %v finds robots.txt failure of %v", attempts, c.retryDelay(attempts), delay)
+		}
+	}
+	c.EnableRobots("CakeBot/1.0", 90*time.Second)
+	c.robots.setup(c.RetryDelay)
+	if c.robots.failureDelay(1) != time.Minute || c.robots.failureDelay(3) != 90*time.Second {
+		t.Errorf("failure delay should be capped by ttl: %v", c.robots.failureDelay(3))
+	}
+}
+
+func TestCrawler_RobotsUserAgent(t *testing.T) {
+	site := createTestSite(map[string][]string{"/": {"/a"}, "/a": nil, "/b": nil})
+	defer site.server.Close()
+	var lock sync.Mutex
+	agents := make(map[string]string)
+	handler := site.server.Config.Handler
+	site.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: cakebot\nAllow: /\n\nUser-agent: *\nDisallow: /\n"))
+			return
+		}
+		lock.Lock()
+		agents[r.URL.Path] = r.UserAgent()
+		lock.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	if e := c.HttpEngine().UseHeaderProfile(network.ProfileDesktopChrome); e != nil {
+		t.Fatal(e)
+	}
+	if e := c.SetUserAgentStrategy(UserAgentRandom); e != nil {
+		t.Fatal(e)
+	}
+	c.EnableRobots("CakeBot/1.0", 0)
+	//sent as another agent, rules of that agent decide
+	c.AddSeeds(&Link{Url: site.server.URL + "/b", Headers: map[string]string{"user-agent": "OtherBot/2.0"}})
+	c.Start()
+	if agents["/"] != "CakeBot/1.0" || agents["/a"] != "CakeBot/1.0" {
+		t.Errorf("pages should be requested as robots agent: %v", agents)
+	}
+	if _, ok := agents["/b"]; ok || c.Stats().Blocked != 1 {
+		t.Errorf("link sent as OtherBot should be blocked: %v %+v", agents, c.Stats())
+	}
+}
@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+//Scope keeps the crawl inside allowed hosts and paths
+//patterns match the whole url: "re:" prefix is a regexp, otherwise a glob where * matches any chars
+type Scope struct {
+	AllowedDomains []string //empty allows all domains
+	DeniedDomains  []string //wins over AllowedDomains
+	ExactDomains   bool     //false: "example.com" also matches "www.example.com"
+	Include        []string //if not empty, url must match one of them
+	Exclude        []string //url matches any of them is out of scope
+	Schemes        []string //empty means http and https
+	include        []*regexp.Regexp
+	exclude        []*regexp.Regexp
+}
+
+//glob or "re:" regexp to regexp
+func compileScopePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		return regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+	}
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
+
+func compileScopePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		r, e := compileScopePattern(pattern)
+		if e != nil {
+			return nil, fmt.Errorf("[Scope] Bad pattern: %s Error: %v", pattern, e)
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+//host is domain or one of its subdomains
+func (s *Scope) matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || (!s.ExactDomains && strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(rawUrl string, patterns []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(rawUrl) {
+			return true
+		}
+	}
+	return false
+}
+
+//absolute url is in scope
+func (s *Scope) InScope(rawUrl string) bool {
+	u, e := url.Parse(rawUrl)
+	if e != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if len(s.Schemes) == 0 {
+		if scheme != "http" && scheme != "https" {
+			return false
+		}
+	} else if !containsFold(s.Schemes, scheme) {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(s.AllowedDomains) > 0 && !s.matchDomain(host, s.AllowedDomains) {
+		return false
+	}
+	if s.matchDomain(host, s.DeniedDomains) {
+		return false
+	}
+	if len(s.include) > 0 && !matchAny(rawUrl, s.include) {
+		return false
+	}
+	return !matchAny(rawUrl, s.exclude)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+//keep found links inside scope, nil to crawl everywhere
+//seeds are always fetched. must be called before Start
+func (c *Crawler) SetScope(scope *Scope) error {
+	if scope != nil {
+		include, e := compileScopePatterns(scope.Include)
+		if e != nil {
+			return e
+		}
+		exclude, e := compileScopePatterns(scope.Exclude)
+		if e != nil {
+			return e
+		}
+		copied := *scope
+		copied.include, copied.exclude = include, exclude
+		scope = &copied
+	}
+	c.scope = scope
+	return nil
+}
+
+//link out of scope is counted and dropped
+func (c *Crawler) outOfScope(link *Link) bool {
+	if c.scope == nil || c.scope.InScope(link.Url) {
+		return false
+	}
+	atomic.AddInt64(&c.outOfScopeLinks, 1)
+	return true
+}
+
+//found links dropped by scope
+func (c *Crawler) OutOfScopeLinks() int64 {
+	return atomic.LoadInt64(&c.outOfScopeLinks)
+}
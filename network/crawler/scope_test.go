@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScope_InScope(t *testing.T) {
+	c := CreateCrawler(nil, nil, "http://example.com/")
+	e := c.SetScope(&Scope{
+		AllowedDomains: []string{"example.com", "other.org"},
+		DeniedDomains:  []string{"ads.example.com"},
+		Include:        []string{"*/news/*", "re:/detail/[0-9]+$"},
+		Exclude:        []string{"*.pdf", "re:[?&]print=1"},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := map[string]bool{
+		"http://example.com/news/1":         true,
+		"https://www.example.com/news/2":    true, //subdomain
+		"http://notexample.com/news/1":      false,
+		"http://ads.example.com/news/1":     false,
+		"http://x.ads.example.com/news/1":   false,
+		"http://other.org/detail/42":        true,
+		"http://other.org/detail/42a":       false,
+		"http://example.com/about":          false, //not included
+		"http://example.com/news/a.pdf":     false,
+		"http://example.com/news/3?print=1": false,
+		"ftp://example.com/news/1":          false,
+		"http://example.com:8080/news/1":    true,
+	}
+	for rawUrl, expected := range cases {
+		if c.scope.InScope(rawUrl) != expected {
+			t.Errorf("url: %s expected in scope: %v", rawUrl, expected)
+		}
+	}
+	if e := c.SetScope(&Scope{Include: []string{"re:("}}); e == nil {
+		t.Errorf("bad regexp should fail")
+	}
+}
+
+func TestScope_ExactDomainsAndSchemes(t *testing.T) {
+	c := CreateCrawler(nil, nil, "http://example.com/")
+	_ = c.SetScope(&Scope{AllowedDomains: []string{"example.com"}, ExactDomains: true, Schemes: []string{"https"}})
+	if c.scope.InScope("https://www.example.com/") || c.scope.InScope("http://example.com/") {
+		t.Errorf("subdomain and http should be out of scope")
+	}
+	if !c.scope.InScope("https://EXAMPLE.com/") {
+		t.Errorf("host should match case insensitive")
+	}
+}
+
+func TestCrawler_Scope(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":       {"/keep/1", "/keep/2", "/skip/1", "/skip/2"},
+		"/keep/1": {"/skip/3"},
+		"/keep/2": nil,
+		"/skip/1": nil,
+	})
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	if e := c.SetScope(&Scope{Exclude: []string{"*/skip/*"}}); e != nil {
+		t.Fatal(e)
+	}
+	c.Start()
+	if c.CurrentFetchedPages != 3 || c.OutOfScopeLinks() != 3 {
+		t.Errorf("expected 3 fetched 3 out of scope, got %d %d", c.CurrentFetchedPages, c.OutOfScopeLinks())
+	}
+	if site.urlPool.Size() != 3 {
+		t.Errorf("out of scope links should not reach url filter, filter saw %d urls", site.urlPool.Size())
+	}
+}
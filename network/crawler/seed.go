@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//load seeds from a newline-delimited file.
+//empty lines and lines start with "#" are ignored
+func LoadSeedsFromFile(path string) ([]*Link, error) {
+	file, e := os.Open(path)
+	if e != nil {
+		return nil, fmt.Errorf("[Seed] Open: %s Error: %v", path, e)
+	}
+	defer func() {
+		e := file.Close()
+		if e != nil {
+			logger.WarnF("[Seed] Close: %s Error: %v", path, e)
+		}
+	}()
+	var seeds []*Link
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, &Link{Url: line})
+	}
+	if e := scanner.Err(); e != nil {
+		return nil, fmt.Errorf("[Seed] Read: %s Error: %v", path, e)
+	}
+	return seeds, nil
+}
+
+//load seeds from a local sitemap xml file, gzipped or not
+//every <loc> is a seed with lastmod and priority in AttrMap.
+//nested sitemaps of a sitemap index are not loaded, use Crawler.LoadSitemap for them
+func LoadSeedsFromSitemapFile(path string) ([]*Link, error) {
+	content, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, fmt.Errorf("[Seed] Read: %s Error: %v", path, e)
+	}
+	seeds, sitemaps, e := ParseSitemap(content)
+	if e != nil {
+		return nil, fmt.Errorf("[Seed] Parse sitemap: %s Error: %v", path, e)
+	}
+	if len(sitemaps) > 0 {
+		logger.WarnF("[Seed] %s has %d nested sitemaps. Skip them!", path, len(sitemaps))
+	}
+	return seeds, nil
+}
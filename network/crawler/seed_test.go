@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"testing"
+)
+
+func TestLoadSeedsFromFile(t *testing.T) {
+	seeds, e := LoadSeedsFromFile("testdata/seeds.txt")
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if len(seeds) != 3 || seeds[2].Url != "https://www.example.com/category/3" {
+		t.Errorf("wrong seeds: %v", seeds)
+	}
+}
+
+func TestLoadSeedsFromSitemapFile(t *testing.T) {
+	seeds, e := LoadSeedsFromSitemapFile("testdata/sitemap.xml")
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if len(seeds) != 2 || seeds[0].Url != "https://www.example.com/detail/1" {
+		t.Errorf("wrong seeds: %v", seeds)
+	}
+	if seeds[0].AttrMap[AttrLastmod] != "2020-01-02" || seeds[0].AttrMap[AttrPriority] != "0.8" {
+		t.Errorf("wrong attrs: %v", seeds[0].AttrMap)
+	}
+}
+
+func TestCrawler_Seeds(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/a": {"/c"},
+		"/b": {"/c"},
+		"/c": nil,
+	})
+	defer site.server.Close()
+	c := CreateCrawlerWithSeeds(site, site, []*Link{
+		{Url: site.server.URL + "/a", AttrMap: map[string]string{"category": "a"}},
+		{Url: site.server.URL + "/b", AttrMap: map[string]string{"category": "b"}},
+	}, &CrawlerOptions{WaitTime: NoWait})
+	c.Start()
+	if c.CurrentFetchedPages != 3 {
+		t.Errorf("expected 3 pages got %d", c.CurrentFetchedPages)
+	}
+	if e := crawlerValid(CreateCrawlerWithSeeds(site, site, nil, nil)); e == nil {
+		t.Errorf("crawler without seeds should be invalid")
+	}
+}
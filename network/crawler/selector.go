@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"strings"
+)
+
+//how a field value is taken from matched element
+const (
+	FieldText = "text" //trimmed text of element and its children
+	FieldAttr = "attr" //value of an attribute
+	FieldHtml = "html" //inner html
+)
+
+//FieldRule extracts one field of item by css selector
+type FieldRule struct {
+	Selector string //relative to item element, "" is the item element itself
+	Type     string //FieldText, FieldAttr or FieldHtml. "" is FieldText
+	Attr     string //attribute name of FieldAttr
+	Multiple bool   //true: []string of all matches, false: string of the first match
+}
+
+func TextField(selector string) *FieldRule {
+	return &FieldRule{Selector: selector, Type: FieldText}
+}
+
+func AttrField(selector string, attr string) *FieldRule {
+	return &FieldRule{Selector: selector, Type: FieldAttr, Attr: attr}
+}
+
+func HtmlField(selector string) *FieldRule {
+	return &FieldRule{Selector: selector, Type: FieldHtml}
+}
+
+//value of one matched element, false if nothing there
+func (rule *FieldRule) value(s *goquery.Selection) (string, bool) {
+	switch rule.Type {
+	case FieldAttr:
+		value, ok := s.Attr(rule.Attr)
+		return strings.TrimSpace(value), ok
+	case FieldHtml:
+		value, e := s.Html()
+		return strings.TrimSpace(value), e == nil
+	default:
+		return strings.TrimSpace(s.Text()), true
+	}
+}
+
+//field value inside item element, nil if nothing matched
+func (rule *FieldRule) extract(element *goquery.Selection) interface{} {
+	selection := element
+	if rule.Selector != "" {
+		selection = element.Find(rule.Selector)
+	}
+	if !rule.Multiple {
+		if selection.Length() == 0 {
+			return nil
+		}
+		if value, ok := rule.value(selection.First()); ok {
+			return value
+		}
+		return nil
+	}
+	var values []string
+	selection.Each(func(i int, s *goquery.Selection) {
+		if value, ok := rule.value(s); ok {
+			values = append(values, value)
+		}
+	})
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+//SelectorProcessor is a Processor configured by css selectors:
+//every element of ItemSelector becomes an Item with Fields, and Links are followed.
+//items are sent to Pipeline of crawler
+type SelectorProcessor struct {
+	ItemSelector string                //each match is one item, "" means the whole page is one item
+	Fields       map[string]*FieldRule //field name -> rule
+	Links        *LinkExtractor        //links to follow, nil follows nothing
+}
+
+func CreateSelectorProcessor(itemSelector string, fields map[string]*FieldRule) *SelectorProcessor {
+	return &SelectorProcessor{ItemSelector: itemSelector, Fields: fields}
+}
+
+func (p *SelectorProcessor) valid() error {
+	for name, rule := range p.Fields {
+		if rule == nil {
+			return fmt.Errorf("field: %s has no rule", name)
+		}
+		if rule.Type == FieldAttr && rule.Attr == "" {
+			return fmt.Errorf("field: %s needs attribute name", name)
+		}
+	}
+	return nil
+}
+
+//items and follow links of a page
+func (p *SelectorProcessor) Extract(html string) ([]Item, []*Link, error) {
+	if e := p.valid(); e != nil {
+		return nil, nil, e
+	}
+	doc, e := goquery.NewDocumentFromReader(bytes.NewReader([]byte(html)))
+	if e != nil {
+		return nil, nil, e
+	}
+	elements := doc.Selection
+	if p.ItemSelector != "" {
+		elements = doc.Find(p.ItemSelector)
+	}
+	var items []Item
+	elements.Each(func(i int, element *goquery.Selection) {
+		item := make(Item)
+		for name, rule := range p.Fields {
+			if value := rule.extract(element); value != nil {
+				item[name] = value
+			}
+		}
+		if len(item) > 0 { //nothing matched, not an item
+			items = append(items, item)
+		}
+	})
+	var links []*Link
+	if p.Links != nil {
+		links = p.Links.Extract(doc.Selection)
+	}
+	return items, links, nil
+}
+
+//bad rules stop the crawl, they fail on every page
+func (p *SelectorProcessor) ProcessItems(link *Link, html string) ([]Item, []*Link, error) {
+	if e := p.valid(); e != nil {
+		return nil, nil, FatalError(e)
+	}
+	return p.Extract(html)
+}
+
+//links only, crawler calls ProcessItems instead
+func (p *SelectorProcessor) Process(link *Link, html string) []*Link {
+	_, links, e := p.ProcessItems(link, html)
+	if e != nil {
+		logger.ErrorF("[Selector] Url: %s Error: %v", link.Url, e)
+	}
+	return links
+}
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectorProcessor_Extract(t *testing.T) {
+	p := CreateSelectorProcessor("div.post", map[string]*FieldRule{
+		"title": TextField("a.title"),
+		"url":   AttrField("a.title", "href"),
+		"html":  HtmlField("a.title"),
+		"view":  TextField("span.view"),
+		"tags":  {Selector: "span.tag", Multiple: true},
+	})
+	p.Links = CreateLinkExtractor("div.pager")
+	items, links, e := p.Extract(readFixture(t, "testdata/list.html"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items got %d: %v", len(items), items)
+	}
+	expected := Item{"title": "First Post", "url": "/post/1", "html": "First <b>Post</b>", "view": "10",
+		"tags": []string{"go", "crawler"}}
+	if !reflect.DeepEqual(items[0], expected) {
+		t.Errorf("wrong item: %v", items[0])
+	}
+	if _, ok := items[1]["tags"]; ok {
+		t.Errorf("missing field should not be set: %v", items[1])
+	}
+	if urls := linkUrls(links); urls != "/page/2 /page/3" {
+		t.Errorf("wrong links: %s", urls)
+	}
+	p.Fields["bad"] = &FieldRule{Type: FieldAttr}
+	if _, _, e := p.Extract(""); e == nil {
+		t.Errorf("attr rule without name should fail")
+	}
+}
+
+func TestCrawler_SelectorProcessor(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/b"},
+		"/b": nil,
+	})
+	defer site.server.Close()
+	var titles []string
+	p := CreateSelectorProcessor("a", map[string]*FieldRule{"title": TextField("")})
+	p.Links = CreateLinkExtractor()
+	c := CreateCrawler(p, site, site.server.URL+"/")
+	c.SetPipeline(CreatePipeline(StageFunc(func(link *Link, item Item) (Item, error) {
+		titles = append(titles, item["title"].(string)) //pipeline calls stages one item at a time
+		return item, nil
+	})))
+	c.WaitTime = time.Nanosecond
+	c.Start()
+	if c.CurrentFetchedPages != 3 {
+		t.Errorf("expected 3 pages got %d", c.CurrentFetchedPages)
+	}
+	if len(titles) != 3 || !strings.Contains(strings.Join(titles, " "), "/a") {
+		t.Errorf("wrong items: %v", titles)
+	}
+}
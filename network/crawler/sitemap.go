@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//AttrMap keys of links found in sitemaps
+const (
+	AttrLastmod  = "lastmod"
+	AttrPriority = "priority"
+)
+
+const (
+	maxSitemapSize  = 50 * 1024 * 1024 //sitemap protocol limit of uncompressed size
+	maxSitemapDepth = 3                //nested sitemap index levels
+)
+
+//<url> of urlset or <sitemap> of sitemapindex
+type sitemapEntry struct {
+	Loc      string `xml:"loc"`
+	Lastmod  string `xml:"lastmod"`
+	Priority string `xml:"priority"`
+}
+
+//both <urlset> and <sitemapindex>
+type sitemapDocument struct {
+	XMLName  xml.Name
+	Urls     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+//parse urlset or sitemapindex, gzipped content is detected by magic bytes
+//links have lastmod and priority in AttrMap, sitemaps are urls of nested sitemaps
+func ParseSitemap(content []byte) (links []*Link, sitemaps []string, e error) {
+	if len(content) > 2 && content[0] == 0x1f && content[1] == 0x8b {
+		reader, e := gzip.NewReader(bytes.NewReader(content))
+		if e != nil {
+			return nil, nil, fmt.Errorf("[Sitemap] Bad gzip: %v", e)
+		}
+		//one more byte to know it is too large, protects against gzip bombs
+		content, e = ioutil.ReadAll(io.LimitReader(reader, maxSitemapSize+1))
+		if e != nil {
+			return nil, nil, fmt.Errorf("[Sitemap] Read gzip: %v", e)
+		}
+		if len(content) > maxSitemapSize {
+			return nil, nil, fmt.Errorf("[Sitemap] Larger than %d bytes", maxSitemapSize)
+		}
+	}
+	document := &sitemapDocument{}
+	if e := xml.Unmarshal(content, document); e != nil {
+		return nil, nil, fmt.Errorf("[Sitemap] Parse xml: %v", e)
+	}
+	switch document.XMLName.Local {
+	case "urlset", "sitemapindex":
+	default:
+		return nil, nil, fmt.Errorf("[Sitemap] Unknown root element: %s", document.XMLName.Local)
+	}
+	for _, entry := range document.Urls {
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" {
+			continue
+		}
+		attrs := make(map[string]string)
+		if lastmod := strings.TrimSpace(entry.Lastmod); lastmod != "" {
+			attrs[AttrLastmod] = lastmod
+		}
+		if priority := strings.TrimSpace(entry.Priority); priority != "" {
+			attrs[AttrPriority] = priority
+		}
+		links = append(links, &Link{Url: loc, AttrMap: attrs})
+	}
+	for _, entry := range document.Sitemaps {
+		if loc := strings.TrimSpace(entry.Loc); loc != "" {
+			sitemaps = append(sitemaps, loc)
+		}
+	}
+	return links, sitemaps, nil
+}
+
+//sitemaps of a site like "https://www.example.com":
+//Sitemap lines of its robots.txt, or /sitemap.xml when there is none
+func (c *Crawler) DiscoverSitemaps(site string) ([]string, error) {
+	target, e := url.Parse(site)
+	if e != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("[Sitemap] Bad site: %s", site)
+	}
+	root := target.Scheme + "://" + target.Host
+	headers := c.requestHeaders()
+	var rules *RobotsRules
+	if c.robots != nil {
+		rules, _ = c.robots.rules(target, c.robots.userAgent) //unreachable falls back to /sitemap.xml
+	} else if response, e := c.httpClient.GetOnce(root+"/robots.txt", headers); e == nil && response.StatusCode == http.StatusOK {
+		rules = ParseRobots(string(response.Body), "")
+	}
+	if rules != nil && len(rules.Sitemaps) > 0 {
+		return rules.Sitemaps, nil
+	}
+	return []string{root + "/sitemap.xml"}, nil
+}
+
+//fetch sitemap and its nested sitemaps, add all links as seeds
+//must be called before Start. return number of seeds added
+func (c *Crawler) LoadSitemap(sitemapUrl string) (int, error) {
+	links, e := c.fetchSitemap(sitemapUrl, 0, make(map[string]bool))
+	c.AddSeeds(links...)
+	logger.InfoF("[Sitemap] %s -> %d seeds", sitemapUrl, len(links))
+	return len(links), e
+}
+
+//discover sitemaps of site and load them all. must be called before Start
+func (c *Crawler) LoadSitemaps(site string) (int, error) {
+	sitemaps, e := c.DiscoverSitemaps(site)
+	if e != nil {
+		return 0, e
+	}
+	total := 0
+	var lastError error
+	for _, sitemapUrl := range sitemaps {
+		n, e := c.LoadSitemap(sitemapUrl)
+		total += n
+		if e != nil {
+			logger.WarnF("%v", e)
+			lastError = e
+		}
+	}
+	if total == 0 && lastError != nil {
+		return 0, lastError
+	}
+	return total, nil
+}
+
+//links of sitemap, broken nested sitemaps are skipped with a warning
+func (c *Crawler) fetchSitemap(sitemapUrl string, depth int, visited map[string]bool) ([]*Link, error) {
+	if visited[sitemapUrl] {
+		return nil, nil
+	}
+	visited[sitemapUrl] = true
+	response, e := c.httpClient.GetOnce(sitemapUrl, c.requestHeaders())
+	if e != nil {
+		return nil, e
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[Sitemap] %s status: %d", sitemapUrl, response.StatusCode)
+	}
+	links, sitemaps, e := ParseSitemap(response.Body)
+	if e != nil {
+		return nil, fmt.Errorf("[Sitemap] %s Error: %v", sitemapUrl, e)
+	}
+	for _, nested := range sitemaps {
+		if depth+1 > maxSitemapDepth {
+			logger.WarnF("[Sitemap] %s nested too deep. Skip!", nested)
+			continue
+		}
+		nestedLinks, e := c.fetchSitemap(nested, depth+1, visited)
+		if e != nil {
+			logger.WarnF("%v", e)
+			continue
+		}
+		links = append(links, nestedLinks...)
+	}
+	return links, nil
+}
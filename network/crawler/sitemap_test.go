@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, content []byte) []byte {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	if _, e := writer.Write(content); e != nil {
+		t.Fatal(e)
+	}
+	if e := writer.Close(); e != nil {
+		t.Fatal(e)
+	}
+	return buffer.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	content, e := os.ReadFile("testdata/sitemap.xml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, data := range [][]byte{content, gzipBytes(t, content)} {
+		links, sitemaps, e := ParseSitemap(data)
+		if e != nil {
+			t.Fatalf("%v", e)
+		}
+		if len(links) != 2 || len(sitemaps) != 0 {
+			t.Fatalf("expected 2 links got %d links %d sitemaps", len(links), len(sitemaps))
+		}
+		if links[0].AttrMap[AttrLastmod] != "2020-01-02" || links[0].AttrMap[AttrPriority] != "0.8" {
+			t.Errorf("wrong attrs: %v", links[0].AttrMap)
+		}
+		if len(links[1].AttrMap) != 0 {
+			t.Errorf("link without lastmod should have no attrs: %v", links[1].AttrMap)
+		}
+	}
+}
+
+func TestParseSitemap_Index(t *testing.T) {
+	content, e := os.ReadFile("testdata/sitemap_index.xml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	links, sitemaps, e := ParseSitemap(content)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if len(links) != 0 || len(sitemaps) != 2 || sitemaps[1] != "https://www.example.com/sitemap-2.xml.gz" {
+		t.Errorf("wrong index: %v %v", links, sitemaps)
+	}
+	if _, _, e := ParseSitemap([]byte("<html></html>")); e == nil {
+		t.Errorf("html should not be a sitemap")
+	}
+}
+
+//site with robots.txt -> sitemap index -> plain and gzipped sitemaps
+func createSitemapSite(t *testing.T, withRobots bool) *httptest.Server {
+	var server *httptest.Server
+	urlSet := func(paths ...string) []byte {
+		content := `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`
+		for _, path := range paths {
+			content += "<url><loc>" + server.URL + path + "</loc><lastmod>2021-05-06</lastmod></url>"
+		}
+		return []byte(content + "</urlset>")
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			if !withRobots {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte("User-agent: *\nSitemap: " + server.URL + "/index.xml\n"))
+		case "/index.xml":
+			_, _ = w.Write([]byte(`<sitemapindex><sitemap><loc>` + server.URL + `/a.xml</loc></sitemap>` +
+				`<sitemap><loc>` + server.URL + `/b.xml.gz</loc></sitemap>` +
+				`<sitemap><loc>` + server.URL + `/index.xml</loc></sitemap></sitemapindex>`))
+		case "/a.xml":
+			_, _ = w.Write(urlSet("/1", "/2"))
+		case "/b.xml.gz":
+			_, _ = w.Write(gzipBytes(t, urlSet("/3")))
+		case "/sitemap.xml":
+			_, _ = w.Write(urlSet("/4"))
+		case "/1", "/2", "/3", "/4":
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server
+}
+
+func TestCrawler_LoadSitemaps(t *testing.T) {
+	server := createSitemapSite(t, true)
+	defer server.Close()
+	site := createTestSite(nil)
+	defer site.server.Close()
+	c := CreateCrawlerWithSeeds(site, site, nil, &CrawlerOptions{WaitTime: NoWait})
+	n, e := c.LoadSitemaps(server.URL)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 seeds from index got %d", n)
+	}
+	for _, seed := range c.seeds {
+		if seed.AttrMap[AttrLastmod] != "2021-05-06" {
+			t.Errorf("seed: %s without lastmod", seed.Url)
+		}
+	}
+	c.Start()
+	if c.CurrentFetchedPages != 3 {
+		t.Errorf("expected 3 pages got %d", c.CurrentFetchedPages)
+	}
+}
+
+func TestCrawler_DiscoverSitemaps(t *testing.T) {
+	server := createSitemapSite(t, false)
+	defer server.Close()
+	site := createTestSite(nil)
+	defer site.server.Close()
+	c := CreateCrawlerWithSeeds(site, site, nil, nil)
+	sitemaps, e := c.DiscoverSitemaps(server.URL + "/any/page")
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if len(sitemaps) != 1 || !strings.HasSuffix(sitemaps[0], "/sitemap.xml") {
+		t.Errorf("expected /sitemap.xml got %v", sitemaps)
+	}
+	if n, e := c.LoadSitemaps(server.URL); e != nil || n != 1 {
+		t.Errorf("expected 1 seed got %d %v", n, e)
+	}
+	if _, e := c.DiscoverSitemaps("not a url"); e == nil {
+		t.Errorf("bad site should fail")
+	}
+}
@@ -0,0 +1,184 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+//links kept in memory before spilling to disk
+const DefaultSpillThreshold = 10000
+
+//FrontierMetrics shows how much the frontier is backed up
+type FrontierMetrics struct {
+	Length    int   //links waiting
+	InMemory  int   //waiting links in memory
+	OnDisk    int   //waiting links spilled to disk
+	MaxLength int   //peak of Length
+	Pushed    int64 //links pushed in total
+	Popped    int64 //links popped in total
+	Spilled   int64 //links written to disk in total
+}
+
+//SpillingFrontier is a FIFO frontier whose Push never blocks
+//links stay in memory until threshold, more links are appended to a temp file
+//and loaded back when memory is used up
+type SpillingFrontier struct {
+	threshold int
+	dir       string //temp file dir, "" is os temp dir
+	memory    []*Link
+	file      *os.File //spill file, created when needed
+	writer    *bufio.Writer
+	readFile  *os.File      //another handle of spill file for reading
+	reader    *bufio.Reader //reads spill file from head
+	onDisk    int
+	metrics   FrontierMetrics
+	lock      sync.Mutex
+}
+
+func (f *SpillingFrontier) savesLinks() {}
+
+//threshold <= 0 uses DefaultSpillThreshold
+func CreateSpillingFrontier(threshold int, dir string) *SpillingFrontier {
+	if threshold <= 0 {
+		threshold = DefaultSpillThreshold
+	}
+	return &SpillingFrontier{threshold: threshold, dir: dir}
+}
+
+func (f *SpillingFrontier) Push(link *Link) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	//once spilled, new links go to disk too to keep order
+	if f.onDisk == 0 && len(f.memory) < f.threshold {
+		f.memory = append(f.memory, link)
+	} else if e := f.spill(link); e != nil {
+		return e
+	}
+	f.metrics.Pushed += 1
+	if length := len(f.memory) + f.onDisk; length > f.metrics.MaxLength {
+		f.metrics.MaxLength = length
+	}
+	return nil
+}
+
+//append link to spill file.must hold lock
+func (f *SpillingFrontier) spill(link *Link) error {
+	if f.file == nil {
+		file, e := os.CreateTemp(f.dir, "cake-frontier-*.jsonl")
+		if e != nil {
+			return fmt.Errorf("[Frontier] Create spill file Error: %v", e)
+		}
+		reader, e := os.Open(file.Name())
+		if e != nil {
+			_ = file.Close()
+			return fmt.Errorf("[Frontier] Open spill file Error: %v", e)
+		}
+		f.file, f.readFile = file, reader
+		f.writer = bufio.NewWriter(file)
+		f.reader = bufio.NewReader(reader)
+		logger.InfoF("[Frontier] More than %d links. Spill to: %s", f.threshold, file.Name())
+	}
+	content, e := json.Marshal(link)
+	if e != nil {
+		return fmt.Errorf("[Frontier] Marshal link: %s Error: %v", link.Url, e)
+	}
+	if _, e := f.writer.Write(append(content, '\n')); e != nil {
+		return fmt.Errorf("[Frontier] Write spill file Error: %v", e)
+	}
+	f.onDisk += 1
+	f.metrics.Spilled += 1
+	return nil
+}
+
+//move a batch of links from disk to memory.must hold lock
+func (f *SpillingFrontier) load() error {
+	if e := f.writer.Flush(); e != nil {
+		return fmt.Errorf("[Frontier] Flush spill file Error: %v", e)
+	}
+	for i := 0; i < f.threshold && f.onDisk > 0; i++ {
+		line, e := f.reader.ReadBytes('\n')
+		if e != nil && !(e == io.EOF && len(line) > 0) {
+			return fmt.Errorf("[Frontier] Read spill file Error: %v", e)
+		}
+		link := &Link{}
+		if e := json.Unmarshal(line, link); e != nil {
+			return fmt.Errorf("[Frontier] Bad link in spill file: %v", e)
+		}
+		f.memory = append(f.memory, link)
+		f.onDisk -= 1
+	}
+	if f.onDisk == 0 { //all loaded, start a new file next time
+		f.removeFile()
+	}
+	return nil
+}
+
+func (f *SpillingFrontier) Pop() (*Link, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.memory) == 0 && f.onDisk > 0 {
+		if e := f.load(); e != nil {
+			return nil, e
+		}
+	}
+	if len(f.memory) == 0 {
+		return nil, nil
+	}
+	link := f.memory[0]
+	f.memory[0] = nil
+	f.memory = f.memory[1:]
+	f.metrics.Popped += 1
+	return link, nil
+}
+
+func (f *SpillingFrontier) Done(link *Link) error {
+	return nil
+}
+
+func (f *SpillingFrontier) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.memory) + f.onDisk
+}
+
+//snapshot of metrics
+func (f *SpillingFrontier) Metrics() *FrontierMetrics {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	metrics := f.metrics
+	metrics.InMemory = len(f.memory)
+	metrics.OnDisk = f.onDisk
+	metrics.Length = metrics.InMemory + metrics.OnDisk
+	return &metrics
+}
+
+//must hold lock
+func (f *SpillingFrontier) removeFile() {
+	if f.file == nil {
+		return
+	}
+	name := f.file.Name()
+	if e := f.file.Close(); e != nil {
+		logger.WarnF("[Frontier] Close spill file Error: %v", e)
+	}
+	if e := f.readFile.Close(); e != nil {
+		logger.WarnF("[Frontier] Close spill file Error: %v", e)
+	}
+	f.file, f.readFile, f.writer, f.reader = nil, nil, nil, nil
+	if e := os.Remove(name); e != nil {
+		logger.WarnF("[Frontier] Remove spill file: %s Error: %v", name, e)
+	}
+}
+
+//spilled links are removed with the temp file
+func (f *SpillingFrontier) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.removeFile()
+	f.onDisk = 0
+	return nil
+}
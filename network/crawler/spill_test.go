@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestSpillingFrontier(t *testing.T) {
+	dir := t.TempDir()
+	f := CreateSpillingFrontier(3, dir)
+	for i := 0; i < 10; i++ {
+		if e := f.Push(&Link{Url: strconv.Itoa(i)}); e != nil {
+			t.Fatalf("%v", e)
+		}
+	}
+	metrics := f.Metrics()
+	if metrics.InMemory != 3 || metrics.OnDisk != 7 || metrics.Spilled != 7 {
+		t.Errorf("wrong metrics: %+v", metrics)
+	}
+	for i := 0; i < 10; i++ {
+		link, e := f.Pop()
+		if e != nil {
+			t.Fatalf("%v", e)
+		}
+		if link == nil || link.Url != strconv.Itoa(i) {
+			t.Fatalf("wrong order at %d: %v", i, link)
+		}
+		if i == 5 { //push while disk is not empty still keeps order
+			_ = f.Push(&Link{Url: "10"})
+		}
+	}
+	if link, _ := f.Pop(); link == nil || link.Url != "10" {
+		t.Errorf("expected link 10 got %v", link)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("spill file should be removed when drained")
+	}
+	if metrics := f.Metrics(); metrics.MaxLength != 10 || metrics.Length != 0 {
+		t.Errorf("wrong metrics: %+v", metrics)
+	}
+}
+
+func TestCrawler_WideSiteSpill(t *testing.T) {
+	pages := map[string][]string{"/": nil}
+	for i := 0; i < 300; i++ {
+		pages["/"] = append(pages["/"], "/"+strconv.Itoa(i))
+		pages["/"+strconv.Itoa(i)] = []string{"/"}
+	}
+	site := createTestSite(pages)
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = 0
+	c.SetFrontier(CreateSpillingFrontier(50, t.TempDir()))
+	c.Start()
+	if c.CurrentFetchedPages != 301 {
+		t.Errorf("expected 301 pages got %d", c.CurrentFetchedPages)
+	}
+	metrics := c.FrontierMetrics()
+	if metrics == nil || metrics.Spilled == 0 || metrics.MaxLength < 300 {
+		t.Errorf("frontier should spill: %+v", metrics)
+	}
+}
@@ -0,0 +1,156 @@
+package crawler
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//HostStats counts pages of one host
+type HostStats struct {
+	Fetched int
+	Failed  int
+	Blocked int
+	Bytes   int64
+}
+
+//Stats is a snapshot of crawl progress, safe to take while crawling
+type Stats struct {
+	Fetched        int           //pages fetched and processed
+	Failed         int           //links given up
+	Blocked        int           //links disallowed by robots.txt
+	Retried        int           //failed links queued again
+	Duplicates     int           //links skipped by url filter or checkpoint
+	OutOfScope     int64         //found links dropped by scope
+	Dropped        int64         //links could not be queued: meta frontier can't save or push failed
+	QueueLength    int           //links waiting in frontier
+	RetryWaiting   int           //failed links waiting for retry delay
+	Held           int           //links held back until their host delay is over
+	InFlight       int           //links being fetched
+	Bytes          int64         //body bytes of fetched pages
+	PagesPerSecond float64       //Fetched / Elapsed
+	Elapsed        time.Duration //since crawl started, frozen when finished
+	Hosts          map[string]*HostStats
+	StopReason     string //"" while running
+}
+
+//counters written by fetch loop, read by Stats
+type crawlStats struct {
+	start      time.Time
+	end        time.Time
+	fetched    int
+	failed     int
+	blocked    int
+	retried    int
+	duplicates int
+	inFlight   int
+	bytes      int64
+	hosts      map[string]*HostStats
+	lock       sync.Mutex
+}
+
+func createCrawlStats() *crawlStats {
+	return &crawlStats{hosts: make(map[string]*HostStats)}
+}
+
+func (s *crawlStats) begin() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.start = time.Now()
+}
+
+func (s *crawlStats) finish() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.end = time.Now()
+}
+
+func (s *crawlStats) dispatched() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.inFlight += 1
+}
+
+func (s *crawlStats) duplicate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.duplicates += 1
+}
+
+//count result of a fetched link
+func (s *crawlStats) record(result *fetchResult) {
+	host := ""
+	if u, e := url.Parse(result.link.Url); e == nil {
+		host = u.Host
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.inFlight -= 1
+	hostStats, ok := s.hosts[host]
+	if !ok {
+		hostStats = &HostStats{}
+		s.hosts[host] = hostStats
+	}
+	s.bytes += int64(result.bytes)
+	hostStats.Bytes += int64(result.bytes)
+	switch result.status {
+	case StatusSuccess:
+		s.fetched += 1
+		hostStats.Fetched += 1
+	case StatusBlocked:
+		s.blocked += 1
+		hostStats.Blocked += 1
+	case StatusRetry:
+		s.retried += 1
+	default:
+		s.failed += 1
+		hostStats.Failed += 1
+	}
+}
+
+//snapshot of progress, can be called any time from any go route
+func (c *Crawler) Stats() *Stats {
+	s := c.stats
+	s.lock.Lock()
+	stats := &Stats{
+		Fetched:    s.fetched,
+		Failed:     s.failed,
+		Blocked:    s.blocked,
+		Retried:    s.retried,
+		Duplicates: s.duplicates,
+		InFlight:   s.inFlight,
+		Bytes:      s.bytes,
+		Hosts:      make(map[string]*HostStats, len(s.hosts)),
+	}
+	for host, hostStats := range s.hosts {
+		copied := *hostStats
+		stats.Hosts[host] = &copied
+	}
+	if !s.start.IsZero() {
+		end := s.end
+		if end.IsZero() {
+			end = time.Now()
+		}
+		stats.Elapsed = end.Sub(s.start)
+	}
+	s.lock.Unlock()
+	if stats.Elapsed > 0 {
+		stats.PagesPerSecond = float64(stats.Fetched) / stats.Elapsed.Seconds()
+	}
+	stats.OutOfScope = atomic.LoadInt64(&c.outOfScopeLinks)
+	stats.Dropped = atomic.LoadInt64(&c.droppedLinks)
+	stats.QueueLength = c.frontier.Len()
+	stats.RetryWaiting = c.retries.Len()
+	stats.Held = c.politeness.Len()
+	stats.StopReason = c.StopReason()
+	return stats
+}
+
+//log progress every ProgressInterval
+func (c *Crawler) logProgress() {
+	stats := c.Stats()
+	logger.InfoF("[Progress] fetched: %d failed: %d blocked: %d duplicates: %d queued: %d retry waiting: %d in flight: %d bytes: %d %.2f pages/s elapsed: %v",
+		stats.Fetched, stats.Failed, stats.Blocked, stats.Duplicates, stats.QueueLength, stats.RetryWaiting,
+		stats.InFlight, stats.Bytes, stats.PagesPerSecond, stats.Elapsed.Round(time.Second))
+}
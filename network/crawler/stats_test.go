@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCrawler_Stats(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/b", "/c", "/missing"},
+		"/b": {"/"},
+		"/c": {},
+	})
+	defer site.server.Close()
+	c := CreateCrawler(site, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	c.ProgressInterval = time.Millisecond
+	if stats := c.Stats(); stats.Elapsed != 0 || stats.Fetched != 0 {
+		t.Errorf("stats before start should be empty: %+v", stats)
+	}
+	handle, e := c.StartAsync()
+	if e != nil {
+		t.Fatal(e)
+	}
+	go func() { //read stats while crawling
+		for {
+			select {
+			case <-handle.Done():
+				return
+			default:
+				c.Stats()
+			}
+		}
+	}()
+	handle.Wait()
+	stats := c.Stats()
+	if stats.Fetched != 4 || stats.Failed != 1 || stats.Duplicates != 2 || stats.InFlight != 0 || stats.QueueLength != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	if stats.Bytes == 0 || stats.PagesPerSecond <= 0 || stats.StopReason != StopReasonFinished {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	host, _ := url.Parse(site.server.URL)
+	if hostStats := stats.Hosts[host.Host]; hostStats == nil || hostStats.Fetched != 4 || hostStats.Failed != 1 {
+		t.Errorf("wrong host stats: %+v", stats.Hosts)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if elapsed := c.Stats().Elapsed; elapsed != stats.Elapsed {
+		t.Errorf("elapsed should be frozen after finish: %v %v", elapsed, stats.Elapsed)
+	}
+	if c.CurrentFetchedPages != stats.Fetched || c.CurrentFailPages != stats.Failed {
+		t.Errorf("deprecated counters should still work: %d %d", c.CurrentFetchedPages, c.CurrentFailPages)
+	}
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+//field names of item in order
+func sortedFields(item Item) []string {
+	fields := make([]string, 0, len(item))
+	for field := range item {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+//JsonLinesWriter is a storage Stage writes every item as one json line
+//every line is flushed, items are kept when crawler crashes or is stopped
+type JsonLinesWriter struct {
+	writer *bufio.Writer
+	closer io.Closer //file opened by writer, nil if given by caller
+}
+
+func CreateJsonLinesWriter(writer io.Writer) *JsonLinesWriter {
+	return &JsonLinesWriter{writer: bufio.NewWriter(writer)}
+}
+
+//create or append file
+func OpenJsonLinesFile(path string) (*JsonLinesWriter, error) {
+	file, e := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		return nil, fmt.Errorf("[Pipeline] Open: %s Error: %v", path, e)
+	}
+	w := CreateJsonLinesWriter(file)
+	w.closer = file
+	return w, nil
+}
+
+func (w *JsonLinesWriter) ProcessItem(link *Link, item Item) (Item, error) {
+	content, e := json.Marshal(item)
+	if e != nil {
+		return nil, e
+	}
+	if _, e := w.writer.Write(append(content, '\n')); e != nil {
+		return nil, e
+	}
+	if e := w.writer.Flush(); e != nil {
+		return nil, e
+	}
+	return item, nil
+}
+
+//flush and close file opened by writer
+func (w *JsonLinesWriter) Close() error {
+	e := w.writer.Flush()
+	if w.closer != nil {
+		if ce := w.closer.Close(); e == nil {
+			e = ce
+		}
+	}
+	return e
+}
+
+//separator of []string values in a csv cell
+const CsvValueSeparator = "|"
+
+//CsvWriter is a storage Stage writes items as csv rows of Columns
+//header is written before the first row, every row is flushed
+type CsvWriter struct {
+	Columns []string
+	writer  *csv.Writer
+	closer  io.Closer
+	header  bool //header written
+}
+
+//columns nil uses fields of the first item
+func CreateCsvWriter(writer io.Writer, columns []string) *CsvWriter {
+	return &CsvWriter{Columns: columns, writer: csv.NewWriter(writer)}
+}
+
+//create or truncate file
+func OpenCsvFile(path string, columns []string) (*CsvWriter, error) {
+	file, e := os.Create(path)
+	if e != nil {
+		return nil, fmt.Errorf("[Pipeline] Create: %s Error: %v", path, e)
+	}
+	w := CreateCsvWriter(file, columns)
+	w.closer = file
+	return w, nil
+}
+
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, CsvValueSeparator)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (w *CsvWriter) ProcessItem(link *Link, item Item) (Item, error) {
+	if !w.header {
+		if w.Columns == nil {
+			w.Columns = sortedFields(item)
+		}
+		if e := w.writer.Write(w.Columns); e != nil {
+			return nil, e
+		}
+		w.header = true
+	}
+	row := make([]string, len(w.Columns))
+	for i, column := range w.Columns {
+		row[i] = csvCell(item[column])
+	}
+	if e := w.writer.Write(row); e != nil {
+		return nil, e
+	}
+	w.writer.Flush()
+	if e := w.writer.Error(); e != nil {
+		return nil, e
+	}
+	return item, nil
+}
+
+func (w *CsvWriter) Close() error {
+	w.writer.Flush()
+	e := w.writer.Error()
+	if w.closer != nil {
+		if ce := w.closer.Close(); e == nil {
+			e = ce
+		}
+	}
+	return e
+}
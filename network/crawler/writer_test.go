@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJsonLinesWriter(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	p := CreatePipeline(CreateJsonLinesWriter(buffer))
+	link := &Link{Url: "http://example.com/"}
+	p.Push(link, Item{"title": "a", "tags": []string{"x", "y"}})
+	p.Push(link, Item{"title": "b", "view": 2})
+	if lines := bytes.Count(buffer.Bytes(), []byte("\n")); lines != 2 {
+		t.Errorf("items should be written before close, got %d lines", lines)
+	}
+	if e := p.Close(); e != nil {
+		t.Fatal(e)
+	}
+	expected := `{"tags":["x","y"],"title":"a"}` + "\n" + `{"title":"b","view":2}` + "\n"
+	if buffer.String() != expected {
+		t.Errorf("wrong json lines: %s", buffer.String())
+	}
+}
+
+func TestCsvWriter(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	w := CreateCsvWriter(buffer, nil)
+	link := &Link{Url: "http://example.com/"}
+	_, _ = w.ProcessItem(link, Item{"title": "a, b", "tags": []string{"x", "y"}})
+	_, _ = w.ProcessItem(link, Item{"title": "c", "other": 1})
+	if lines := bytes.Count(buffer.Bytes(), []byte("\n")); lines != 3 {
+		t.Errorf("rows should be written before close, got %d lines", lines)
+	}
+	if e := w.Close(); e != nil {
+		t.Fatal(e)
+	}
+	expected := "tags,title\nx|y,\"a, b\"\n,c\n"
+	if buffer.String() != expected {
+		t.Errorf("wrong csv: %q", buffer.String())
+	}
+}
+
+func TestCrawler_Pipeline(t *testing.T) {
+	site := createTestSite(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/b"},
+		"/b": nil,
+	})
+	defer site.server.Close()
+	dir := t.TempDir()
+	jsonWriter, e := OpenJsonLinesFile(filepath.Join(dir, "items.jsonl"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	csvWriter, e := OpenCsvFile(filepath.Join(dir, "items.csv"), []string{"href"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	p := CreateSelectorProcessor("a", map[string]*FieldRule{"href": AttrField("", "href")})
+	p.Links = CreateLinkExtractor()
+	c := CreateCrawler(p, site, site.server.URL+"/")
+	c.WaitTime = time.Nanosecond
+	pipeline := CreatePipeline(DedupeStage("href"), jsonWriter, csvWriter)
+	c.SetPipeline(pipeline)
+	c.Start()
+	if metrics := pipeline.Metrics(); metrics.Items != 3 || metrics.Passed != 2 {
+		t.Errorf("wrong metrics: %+v", metrics)
+	}
+	lines, _ := os.ReadFile(filepath.Join(dir, "items.jsonl"))
+	if bytes.Count(lines, []byte("\n")) != 2 {
+		t.Errorf("expected 2 json lines: %s", lines)
+	}
+	rows, _ := os.ReadFile(filepath.Join(dir, "items.csv"))
+	if string(rows) != "href\n/a\n/b\n" && string(rows) != "href\n/b\n/a\n" {
+		t.Errorf("wrong csv file: %q", rows)
+	}
+}
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//resolved addresses of one host
+type dnsEntry struct {
+	ips    []string
+	expire time.Time
+}
+
+//resolver of engine: static overrides first, then cache, then system resolver
+type resolver struct {
+	overrides map[string][]string //host -> ips, like /etc/hosts
+	ttl       time.Duration       //cache time, 0 means no cache
+	cache     map[string]*dnsEntry
+	lock      sync.RWMutex
+	dialer    *net.Dialer
+	lookup    func(ctx context.Context, host string) ([]string, error)
+	hits      int64 //answered by cache
+	misses    int64 //answered by system resolver
+}
+
+func createResolver() *resolver {
+	return &resolver{
+		overrides: make(map[string][]string),
+		cache:     make(map[string]*dnsEntry),
+		dialer: &net.Dialer{
+			Timeout:   Timeout,
+			KeepAlive: 30 * time.Second,
+		},
+		lookup: net.DefaultResolver.LookupHost,
+	}
+}
+
+//ips of host. overrides are never expired
+func (r *resolver) resolve(ctx context.Context, host string) ([]string, error) {
+	host = strings.ToLower(host)
+	r.lock.RLock()
+	if ips, ok := r.overrides[host]; ok {
+		r.lock.RUnlock()
+		return ips, nil
+	}
+	ttl := r.ttl
+	if entry, ok := r.cache[host]; ok && time.Now().Before(entry.expire) {
+		r.lock.RUnlock()
+		atomic.AddInt64(&r.hits, 1)
+		return entry.ips, nil
+	}
+	r.lock.RUnlock()
+
+	ips, e := r.lookup(ctx, host)
+	if e != nil {
+		return nil, e
+	}
+	if ttl > 0 {
+		atomic.AddInt64(&r.misses, 1)
+		r.lock.Lock()
+		r.cache[host] = &dnsEntry{ips: ips, expire: time.Now().Add(ttl)}
+		r.lock.Unlock()
+		logger.DebugF("[DNS] Host: %s -> %v cached for %v", host, ips, ttl)
+	}
+	return ips, nil
+}
+
+//used as transport DialContext. try resolved ips one by one
+func (r *resolver) dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, e := net.SplitHostPort(address)
+	if e != nil {
+		return nil, e
+	}
+	if net.ParseIP(host) != nil {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+	r.lock.RLock()
+	passThrough := r.ttl <= 0 && len(r.overrides) == 0
+	r.lock.RUnlock()
+	if passThrough {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+	ips, e := r.resolve(ctx, host)
+	if e != nil {
+		return nil, e
+	}
+	var lastError error
+	for _, ip := range ips {
+		conn, e := r.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if e == nil {
+			return conn, nil
+		}
+		lastError = e
+	}
+	if lastError == nil {
+		lastError = fmt.Errorf("[DNS] Host: %s has no address", host)
+	}
+	return nil, lastError
+}
+
+//cache resolved hosts for ttl, 0 to disable cache
+func (engine *HttpEngine) SetDNSCache(ttl time.Duration) {
+	engine.resolver.lock.Lock()
+	defer engine.resolver.lock.Unlock()
+	engine.resolver.ttl = ttl
+	if ttl <= 0 {
+		engine.resolver.cache = make(map[string]*dnsEntry)
+	}
+}
+
+//static host -> ip map like /etc/hosts, replace old overrides
+//it is useful to point real host names at local test servers
+func (engine *HttpEngine) SetHostOverrides(overrides map[string]string) {
+	copied := make(map[string][]string, len(overrides))
+	for host, ip := range overrides {
+		copied[strings.ToLower(host)] = []string{ip}
+	}
+	engine.resolver.lock.Lock()
+	defer engine.resolver.lock.Unlock()
+	engine.resolver.overrides = copied
+}
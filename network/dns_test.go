@@ -0,0 +1,54 @@
+package network
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHttpEngine_HostOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	httpEngine := CreateEngine()
+	httpEngine.SetHostOverrides(map[string]string{"www.example.com": serverUrl.Hostname()})
+	html, e := httpEngine.Get("http://www.example.com:"+serverUrl.Port()+"/", nil)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != "www.example.com:"+serverUrl.Port() {
+		t.Errorf("host header should keep real name: %s", html)
+	}
+}
+
+func TestResolver_Cache(t *testing.T) {
+	r := createResolver()
+	lookups := 0
+	r.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups += 1
+		return []string{"127.0.0.1"}, nil
+	}
+	r.ttl = 50 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		ips, e := r.resolve(context.Background(), "cake.test")
+		if e != nil || len(ips) != 1 || net.ParseIP(ips[0]) == nil {
+			t.Fatalf("wrong resolve: %v %v", ips, e)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("expected 1 lookup, got %d", lookups)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, e := r.resolve(context.Background(), "cake.test"); e != nil {
+		t.Fatalf("%v", e)
+	}
+	if lookups != 2 || r.hits != 2 || r.misses != 2 {
+		t.Errorf("expired entry should be resolved again: lookups %d hits %d misses %d", lookups, r.hits, r.misses)
+	}
+}
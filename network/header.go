@@ -0,0 +1,201 @@
+package network
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//names of built-in header profiles
+const (
+	ProfileDesktopChrome  = "desktop-chrome"
+	ProfileDesktopFirefox = "desktop-firefox"
+	ProfileMobileSafari   = "mobile-safari"
+	ProfileMobileChrome   = "mobile-chrome"
+)
+
+//HeaderProfiles is a named set of headers which looks like a real browser
+//use engine.UseHeaderProfile(name) to apply one as default headers
+var HeaderProfiles = map[string]map[string]string{
+	ProfileDesktopChrome: {
+		"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		"Accept-Language":           "en-US,en;q=0.9",
+		"Cache-Control":             "max-age=0",
+		"Upgrade-Insecure-Requests": "1",
+		"Sec-Fetch-Dest":            "document",
+		"Sec-Fetch-Mode":            "navigate",
+		"Sec-Fetch-Site":            "none",
+		"Sec-Fetch-User":            "?1",
+	},
+	ProfileDesktopFirefox: {
+		"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		"Accept-Language":           "en-US,en;q=0.5",
+		"Upgrade-Insecure-Requests": "1",
+		"Sec-Fetch-Dest":            "document",
+		"Sec-Fetch-Mode":            "navigate",
+		"Sec-Fetch-Site":            "none",
+	},
+	ProfileMobileSafari: {
+		"User-Agent":      "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"Accept-Language": "en-US,en;q=0.9",
+	},
+	ProfileMobileChrome: {
+		"User-Agent":                "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		"Accept-Language":           "en-US,en;q=0.9",
+		"Upgrade-Insecure-Requests": "1",
+	},
+}
+
+//UserAgentRotator choose a user agent for every request
+type UserAgentRotator interface {
+	//return user agent for the request which will be sent to host
+	Next(host string) string
+}
+
+//pick a random agent for every request
+type randomRotator struct {
+	agents []string
+	random *rand.Rand
+	lock   sync.Mutex //rand.Rand is not thread safe
+}
+
+func (r *randomRotator) Next(host string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.agents[r.random.Intn(len(r.agents))]
+}
+
+//pick agents one by one
+type roundRobinRotator struct {
+	agents []string
+	index  uint64
+}
+
+func (r *roundRobinRotator) Next(host string) string {
+	i := atomic.AddUint64(&r.index, 1) - 1
+	return r.agents[i%uint64(len(r.agents))]
+}
+
+//same host always gets the same agent
+type stickyRotator struct {
+	agents []string
+}
+
+func (r *stickyRotator) Next(host string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(host))
+	return r.agents[h.Sum32()%uint32(len(r.agents))]
+}
+
+func rotatorAgentsValid(agents []string) error {
+	if len(agents) == 0 {
+		return fmt.Errorf("user agent list is empty. Nothing to rotate")
+	}
+	return nil
+}
+
+//random agent for every request
+func CreateRandomRotator(agents []string) (UserAgentRotator, error) {
+	if e := rotatorAgentsValid(agents); e != nil {
+		return nil, e
+	}
+	return &randomRotator{
+		agents: agents,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+//agents are used in order, start over when reach the end
+func CreateRoundRobinRotator(agents []string) (UserAgentRotator, error) {
+	if e := rotatorAgentsValid(agents); e != nil {
+		return nil, e
+	}
+	return &roundRobinRotator{agents: agents}, nil
+}
+
+//one agent per host, picked by host hash
+func CreateStickyRotator(agents []string) (UserAgentRotator, error) {
+	if e := rotatorAgentsValid(agents); e != nil {
+		return nil, e
+	}
+	return &stickyRotator{agents: agents}, nil
+}
+
+//replace engine default headers.they are sent with every request
+func (engine *HttpEngine) SetDefaultHeaders(headers map[string]string) {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+	engine.headerLock.Lock()
+	defer engine.headerLock.Unlock()
+	engine.defaultHeaders = copied
+}
+
+//add or replace one default header
+func (engine *HttpEngine) AddDefaultHeader(key string, value string) {
+	engine.headerLock.Lock()
+	defer engine.headerLock.Unlock()
+	if engine.defaultHeaders == nil {
+		engine.defaultHeaders = make(map[string]string)
+	}
+	engine.defaultHeaders[key] = value
+}
+
+//merge a named profile in HeaderProfiles into default headers
+func (engine *HttpEngine) UseHeaderProfile(name string) error {
+	profile, ok := HeaderProfiles[name]
+	if !ok {
+		return fmt.Errorf("header profile: \"%s\" not found", name)
+	}
+	for k, v := range profile {
+		engine.AddDefaultHeader(k, v)
+	}
+	return nil
+}
+
+//rotator decides User-Agent of every request, nil to disable
+func (engine *HttpEngine) SetUserAgentRotator(rotator UserAgentRotator) {
+	engine.headerLock.Lock()
+	defer engine.headerLock.Unlock()
+	engine.userAgentRotator = rotator
+}
+
+//true when default headers or rotator decide User-Agent
+func (engine *HttpEngine) HasUserAgent() bool {
+	engine.headerLock.RLock()
+	defer engine.headerLock.RUnlock()
+	if engine.userAgentRotator != nil {
+		return true
+	}
+	for k := range engine.defaultHeaders {
+		if http.CanonicalHeaderKey(k) == "User-Agent" {
+			return true
+		}
+	}
+	return false
+}
+
+//headers priority: default headers < rotator user agent < request headers
+func (engine *HttpEngine) applyHeaders(request *http.Request, headers map[string]string) {
+	engine.headerLock.RLock()
+	for k, v := range engine.defaultHeaders {
+		request.Header.Set(k, v)
+	}
+	if engine.userAgentRotator != nil {
+		request.Header.Set("User-Agent", engine.userAgentRotator.Next(request.URL.Host))
+	}
+	engine.headerLock.RUnlock()
+	for k, v := range headers {
+		logger.DebugF("[%s] Url: %s Add Header: [%s : %s]", request.Method, request.URL, k, v)
+		request.Header.Set(k, v)
+	}
+}
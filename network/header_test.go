@@ -0,0 +1,97 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//server echo request User-Agent and Accept-Language back
+func createHeaderEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("User-Agent") + "|" + r.Header.Get("Accept-Language")))
+	}))
+}
+
+func TestHttpEngine_DefaultHeaders(t *testing.T) {
+	server := createHeaderEchoServer()
+	defer server.Close()
+	httpEngine := CreateEngine()
+	if e := httpEngine.UseHeaderProfile(ProfileMobileSafari); e != nil {
+		t.Fatalf("%v", e)
+	}
+	profile := HeaderProfiles[ProfileMobileSafari]
+	html, e := httpEngine.Get(server.URL, nil)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != profile["User-Agent"]+"|"+profile["Accept-Language"] {
+		t.Errorf("profile headers not sent: %s", html)
+	}
+	//request headers win
+	html, e = httpEngine.Get(server.URL, map[string]string{"User-Agent": "cake"})
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != "cake|"+profile["Accept-Language"] {
+		t.Errorf("request header not override default: %s", html)
+	}
+	if e := httpEngine.UseHeaderProfile("unknown"); e == nil {
+		t.Errorf("unknown profile should fail")
+	}
+}
+
+func TestUserAgentRotator(t *testing.T) {
+	agents := []string{"a", "b", "c"}
+	roundRobin, _ := CreateRoundRobinRotator(agents)
+	for i := 0; i < 6; i++ {
+		if agent := roundRobin.Next("x.com"); agent != agents[i%3] {
+			t.Errorf("round robin %d got %s", i, agent)
+		}
+	}
+	sticky, _ := CreateStickyRotator(agents)
+	first := sticky.Next("x.com")
+	for i := 0; i < 5; i++ {
+		if agent := sticky.Next("x.com"); agent != first {
+			t.Errorf("sticky changed agent %s -> %s", first, agent)
+		}
+	}
+	random, _ := CreateRandomRotator(agents)
+	for i := 0; i < 5; i++ {
+		agent := random.Next("x.com")
+		if agent != "a" && agent != "b" && agent != "c" {
+			t.Errorf("random got unknown agent %s", agent)
+		}
+	}
+	httpEngine := CreateEngine()
+	if httpEngine.HasUserAgent() {
+		t.Errorf("new engine has no user agent")
+	}
+	httpEngine.AddDefaultHeader("user-agent", "bot")
+	if !httpEngine.HasUserAgent() {
+		t.Errorf("default header should set user agent")
+	}
+	if _, e := CreateStickyRotator(nil); e == nil {
+		t.Errorf("empty agent list should fail")
+	}
+}
+
+func TestHttpEngine_UserAgentRotator(t *testing.T) {
+	server := createHeaderEchoServer()
+	defer server.Close()
+	httpEngine := CreateEngine()
+	rotator, e := CreateRoundRobinRotator([]string{"first", "second"})
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	httpEngine.SetUserAgentRotator(rotator)
+	for _, expected := range []string{"first|", "second|", "first|"} {
+		html, e := httpEngine.Get(server.URL, nil)
+		if e != nil {
+			t.Fatalf("%v", e)
+		}
+		if html != expected {
+			t.Errorf("expected %s got %s", expected, html)
+		}
+	}
+}
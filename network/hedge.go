@@ -0,0 +1,149 @@
+package network
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//latency samples kept for percentile
+const latencyWindowSize = 200
+
+//HedgeConfig decides when a second attempt of a slow GET is fired
+//if both Delay and Percentile are set, the earlier one wins
+type HedgeConfig struct {
+	Delay      time.Duration //fire hedge after this delay. 0 to use Percentile only
+	Percentile float64       //fire hedge when request is slower than this percentile of recent latency, like 0.95. 0 to use Delay only
+	MinSamples int           //Percentile is used only when there are this many samples
+}
+
+//recent latency of successful attempts
+type latencyWindow struct {
+	samples []time.Duration //ring buffer
+	next    int
+	count   int
+	lock    sync.Mutex
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.count < len(w.samples) {
+		w.count += 1
+	}
+}
+
+//percentile of samples. false if not enough samples
+func (w *latencyWindow) percentile(p float64, minSamples int) (time.Duration, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.count == 0 || w.count < minSamples {
+		return 0, false
+	}
+	sorted := make([]time.Duration, w.count)
+	copy(sorted, w.samples[:w.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(p * float64(w.count))
+	if index >= w.count {
+		index = w.count - 1
+	}
+	return sorted[index], true
+}
+
+type hedging struct {
+	config  *HedgeConfig
+	latency *latencyWindow
+	fired   int64 //hedge attempts sent
+	won     int64 //hedge attempts finished first
+}
+
+//delay before hedge. false means no hedge for this request
+func (h *hedging) delay() (time.Duration, bool) {
+	delay := h.config.Delay
+	if h.config.Percentile > 0 {
+		if p, ok := h.latency.percentile(h.config.Percentile, h.config.MinSamples); ok && (delay <= 0 || p < delay) {
+			delay = p
+		}
+	}
+	return delay, delay > 0
+}
+
+//result of one attempt
+type attemptResult struct {
+	response *http.Response
+	bytes    []byte
+	e        error
+	hedge    bool //true is the second attempt
+}
+
+//error or server error, worse than the other attempt
+func (r *attemptResult) failed() bool {
+	return r.e != nil || isHostFailure(r.response.StatusCode)
+}
+
+//enable hedged requests for idempotent GET, nil config to disable
+//call it before engine is used
+func (engine *HttpEngine) SetHedging(config *HedgeConfig) {
+	if config == nil {
+		engine.hedging = nil
+		return
+	}
+	engine.hedging = &hedging{
+		config:  config,
+		latency: &latencyWindow{samples: make([]time.Duration, latencyWindowSize)},
+	}
+}
+
+//send request, if it is slow fire a second one.first finished wins,the other is canceled
+//the hedge attempt holds its own semaphore, caller already holds one for the first attempt
+func (engine *HttpEngine) hedgedRoundTrip(request *http.Request) (*http.Response, []byte, error) {
+	delay, ok := engine.hedging.delay()
+	if !ok {
+		return engine.roundTrip(request)
+	}
+	ctx, cancel := context.WithCancel(request.Context())
+	defer cancel() //loser is canceled
+	results := make(chan *attemptResult, 2)
+	attempt := func(r *http.Request, hedge bool) {
+		response, bytes, e := engine.roundTrip(r)
+		results <- &attemptResult{response: response, bytes: bytes, e: e, hedge: hedge}
+	}
+	go attempt(request.WithContext(ctx), false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.response, r.bytes, r.e
+	case <-timer.C:
+	}
+	//hedge needs a semaphore too. first attempt may finish while waiting
+	select {
+	case engine.sem <- struct{}{}:
+	case r := <-results:
+		return r.response, r.bytes, r.e
+	}
+	atomic.AddInt64(&engine.hedging.fired, 1)
+	logger.DebugF("[%s] Url: %s slower than %v. Send hedge request", request.Method, request.URL, delay)
+	go func(r *http.Request) {
+		defer func() { <-engine.sem }()
+		attempt(r, true)
+	}(request.Clone(ctx))
+
+	first := <-results
+	if first.failed() { //one failed, the other one may still succeed
+		second := <-results
+		if !second.failed() {
+			first = second
+		}
+	}
+	if first.e == nil && first.hedge {
+		atomic.AddInt64(&engine.hedging.won, 1)
+	}
+	return first.response, first.bytes, first.e
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHttpEngine_Hedging(t *testing.T) {
+	var requests int32
+	//first request is very slow, the hedge one is fast
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	httpEngine := CreateEngine()
+	httpEngine.SetHedging(&HedgeConfig{Delay: 50 * time.Millisecond})
+	start := time.Now()
+	html, e := httpEngine.Get(server.URL, nil)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != "ok" {
+		t.Errorf("wrong response: %s", html)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("hedge should finish early, cost: %v", cost)
+	}
+	metrics := httpEngine.Metrics()
+	if metrics.HedgesFired != 1 || metrics.HedgesWon != 1 {
+		t.Errorf("wrong metrics: %+v", metrics)
+	}
+	//fast request no hedge
+	if _, e := httpEngine.Get(server.URL, nil); e != nil {
+		t.Fatalf("%v", e)
+	}
+	if metrics := httpEngine.Metrics(); metrics.HedgesFired != 1 {
+		t.Errorf("fast request should not hedge: %+v", metrics)
+	}
+}
+
+func TestHttpEngine_HedgeServerError(t *testing.T) {
+	var requests int32
+	//first request is slow but fine, the hedge one fails at once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte("ok"))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	httpEngine := CreateEngine()
+	httpEngine.SetHedging(&HedgeConfig{Delay: 50 * time.Millisecond})
+	html, e := httpEngine.Get(server.URL, nil)
+	if e != nil {
+		t.Fatalf("%v", e)
+	}
+	if html != "ok" || atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("slow success should win over fast 503: %s after %d requests", html, requests)
+	}
+}
+
+func TestLatencyWindow_Percentile(t *testing.T) {
+	w := &latencyWindow{samples: make([]time.Duration, 10)}
+	if _, ok := w.percentile(0.9, 1); ok {
+		t.Errorf("empty window has no percentile")
+	}
+	for i := 1; i <= 20; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	//only 11..20 are kept
+	if p, _ := w.percentile(0.5, 1); p != 16*time.Millisecond {
+		t.Errorf("wrong p50: %v", p)
+	}
+	if p, _ := w.percentile(1, 1); p != 20*time.Millisecond {
+		t.Errorf("wrong p100: %v", p)
+	}
+}
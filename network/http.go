@@ -1,7 +1,9 @@
 package network
 
 import (
+	"bytes"
 	"cake/util"
+	"context"
 	"cake/util/log"
 	"fmt"
 	"io"
@@ -9,6 +11,8 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,6 +32,14 @@ type HttpEngine struct{
 	retries int //when fail in any issue,retry times
 	client *http.Client //do real http network
 	sem chan struct{} //for control concurrent go route
+	defaultHeaders map[string]string //sent with every request
+	userAgentRotator UserAgentRotator //choose User-Agent for every request
+	headerLock sync.RWMutex //guard default headers and rotator
+	authenticators map[string]Authenticator //credentials per host
+	authLock sync.RWMutex //guard authenticators
+	breakers *circuitBreakers //per host circuit breaker, nil is disabled
+	hedging *hedging //hedged GET requests, nil is disabled
+	resolver *resolver //dns cache and static host overrides
 }
 
 func CreateEngine() *HttpEngine{
@@ -35,8 +47,12 @@ func CreateEngine() *HttpEngine{
 }
 
 func CreateEngineByParams(maxConnections int, timeout time.Duration, retries int) *HttpEngine{
+	resolver := createResolver()
+	transport := createTransport()
+	transport.DialContext = resolver.dialContext //dns cache and host overrides
 	client := &http.Client{
 		Timeout: timeout,
+		Transport: transport,
 	}
 	engine := &HttpEngine{
 		maxConnections: maxConnections,
@@ -44,78 +60,248 @@ func CreateEngineByParams(maxConnections int, timeout time.Duration, retries int
 		retries:        retries,
 		client:         client,
 		sem:            make(chan struct{},maxConnections),
+		resolver:       resolver,
 	}
 	return engine
 }
 
+//transport with settings of http.DefaultTransport. a new one is built,
+//DefaultTransport may be replaced by another RoundTripper, like instrumentation or mocks do
+func createTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+//new request with default headers,user agent,request headers and credentials
+func (engine *HttpEngine) createRequest(method string,url string,headers map[string]string,body io.Reader) (*http.Request,error){
+	request, e := http.NewRequest(method, url, body)
+	if e != nil {
+		return nil,e
+	}
+	engine.applyHeaders(request,headers)
+	if e := engine.applyAuth(request); e != nil {
+		return nil,fmt.Errorf("[%s] Url: %s Authenticate Error: %v",method,url,e)
+	}
+	return request,nil
+}
+
 //Get method to fetch all content into string
 //sync network request in common go route
 func (engine *HttpEngine) Get(url string,headers map[string]string) (string,error){
-	engine.sem <- struct{}{} //get sem if full , that will block
-	defer func(){ <- engine.sem}() // function end, sem is returned
-
-	request, e := http.NewRequest("GET", url, nil)
+	response, e := engine.GetResponse(url,headers)
 	if e != nil {
 		return "",e
 	}
-	//need add header
-	if headers != nil && len(headers) > 0 {
-		for k,v := range headers {
-			logger.DebugF("[GET] Url: %s Add Header: [%s : %s]",url,k,v)
-			request.Header.Set(k,v)
+	return string(response.Body),nil
+}
+
+//GetResponse is Get with final url and headers of response, status is always 200
+func (engine *HttpEngine) GetResponse(url string,headers map[string]string) (*Response,error){
+	return engine.Do(&Request{Url: url,Headers: headers})
+}
+
+//Request is a request of any method with body, cookies and its own timeout
+type Request struct {
+	Method  string //GET when empty
+	Url     string
+	Headers map[string]string //set over default headers
+	Body    []byte //sent again on every retry
+	Cookies map[string]string //replace Cookie header when not empty
+	Timeout time.Duration //0 is engine timeout, can't be longer than it
+	Idempotent bool //safe to send again, POST and PATCH are only retried when it is set
+}
+
+//GET, HEAD, PUT, DELETE, OPTIONS and TRACE may be sent again, others only when Idempotent
+func (r *Request) Retryable() bool {
+	switch strings.ToUpper(r.Method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return r.Idempotent
+}
+
+//new http request of Request, cancel must be called when response is read
+func (engine *HttpEngine) createRequestOf(r *Request,method string) (*http.Request,context.CancelFunc,error){
+	var body io.Reader
+	if len(r.Body) > 0 {
+		body = bytes.NewReader(r.Body)
+	}
+	request, e := engine.createRequest(method, r.Url, r.Headers, body)
+	if e != nil {
+		return nil,nil,e
+	}
+	if len(r.Cookies) > 0 {
+		request.Header.Del("Cookie")
+		for name, value := range r.Cookies {
+			request.AddCookie(&http.Cookie{Name: name,Value: value})
 		}
 	}
+	cancel := context.CancelFunc(func(){})
+	if r.Timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(request.Context(),r.Timeout)
+		request = request.WithContext(ctx)
+	}
+	return request,cancel,nil
+}
+
+//Do sends request with retries like GetResponse, status of response is always 200
+//request which is not Retryable is sent once, except a retry after credentials refreshed
+func (engine *HttpEngine) Do(r *Request) (*Response,error){
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	retries := engine.retries
+	if !r.Retryable() {
+		retries = 1
+	}
+	engine.sem <- struct{}{} //get sem if full , that will block
+	defer func(){ <- engine.sem}() // function end, sem is returned
+
 	retryCount := 0
+	refreshed := false //credentials only refresh once
 RETRY_LOOP:
-	response, e := engine.client.Do(request)
+	request, cancel, e := engine.createRequestOf(r, method)
+	if e != nil {
+		return nil,e
+	}
+	if e := engine.breakerAllow(request.URL.Host); e != nil {
+		cancel()
+		return nil,e
+	}
+	response, bytes, e := engine.execute(request)
+	cancel() //body is read already
 	if e != nil {
-		logger.WarnF("[GET] Retries: %d -> Http Url: \"%s\" Error: %v",retryCount,url,e)
+		engine.breakerRecord(request.URL.Host,true)
+		logger.WarnF("[%s] Retries: %d -> Http Url: \"%s\" Error: %v",method,retryCount,r.Url,e)
 		retryCount += 1
-		if retryCount >= engine.retries{
-			return "",fmt.Errorf("[GET] Retry \""+strconv.Itoa(engine.retries)+
-				"\" but still can't Get Url: "+url+" status: "+strconv.Itoa(response.StatusCode))
+		if retryCount >= retries{
+			return nil,fmt.Errorf("[%s] Retry \"%d\" but still can't %s Url: %s Error: %w",method,retries,strings.Title(strings.ToLower(method)),r.Url,e)
 		}
 		time.Sleep(util.GetTimeSecond(1))
 		goto RETRY_LOOP
 	}
+	engine.breakerRecord(request.URL.Host,isHostFailure(response.StatusCode))
+	if response.StatusCode == http.StatusUnauthorized && !refreshed && engine.refreshAuth(request) {
+		logger.InfoF("[%s] 401 -> %s credentials refreshed. Retry",method,r.Url)
+		refreshed = true
+		goto RETRY_LOOP
+	}
 	if response.StatusCode == 200 {
-		bytes, e := ioutil.ReadAll(response.Body)
-		if e != nil {
-			logger.WarnF("[GET] Retries: %d -> Http ReadAll: \"%s\" Error: %v",retryCount,url,e)
-			retryCount += 1
-			if retryCount >= engine.retries{
-				return "",fmt.Errorf("[GET] Retry \""+strconv.Itoa(engine.retries)+
-					"\" but still can't Read Url: "+url+" All Data, status: "+strconv.Itoa(response.StatusCode))
-			}
-			e := response.Body.Close()
-			if e != nil {
-				logger.WarnF("[GET] Http Get Response Close Error: %v",e)
-			}
-			time.Sleep(util.GetTimeSecond(1))
-			goto RETRY_LOOP
-		}
-		logger.Info("[GET] 200 -> "+url)
-		defer func() {
-			e := response.Body.Close()
-			if e != nil {
-				logger.WarnF("[GET] Http Get Response Close Error: %v",e)
-			}
-		}()
-		return string(bytes),nil
+		logger.InfoF("[%s] 200 -> %s",method,r.Url)
+		return &Response{
+			Url:        response.Request.URL.String(),
+			StatusCode: response.StatusCode,
+			Header:     response.Header,
+			Body:       bytes,
+		},nil
 	} else {
-		logger.WarnF("[GET] Retries: %d -> Http Status: %d",retryCount,response.StatusCode)
+		logger.WarnF("[%s] Retries: %d -> Http Status: %d",method,retryCount,response.StatusCode)
 		retryCount += 1
-		if retryCount >= engine.retries{
-			return "",fmt.Errorf("[GET] Retry \""+strconv.Itoa(engine.retries)+
-				"\" but still can't Get Url: "+url+" status: "+strconv.Itoa(response.StatusCode))
+		if retryCount >= retries{
+			last := &Response{
+				Url:        response.Request.URL.String(),
+				StatusCode: response.StatusCode,
+				Header:     response.Header,
+				Body:       bytes,
+			}
+			return nil,&StatusError{Method: method,Url: r.Url,StatusCode: response.StatusCode,Retries: retries,Response: last}
 		}
+		time.Sleep(util.GetTimeSecond(1))
+		goto RETRY_LOOP
+	}
+}
+
+//error returned when status is still not 200 after all retries
+type StatusError struct {
+	Method     string //GET when empty
+	Url        string
+	StatusCode int
+	Retries    int
+	Response   *Response //last response with its header and body, nil if not from Do
+}
+
+func (e *StatusError) Error() string {
+	method := e.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return "["+method+"] Retry \""+strconv.Itoa(e.Retries)+"\" but still can't "+strings.Title(strings.ToLower(method))+" Url: "+e.Url+" status: "+strconv.Itoa(e.StatusCode)
+}
+
+//Response of a finished request, any status
+type Response struct {
+	Url        string //final url after redirects
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+//GetOnce sends one GET without retry and returns response of any status
+//error only when no response was received
+func (engine *HttpEngine) GetOnce(url string,headers map[string]string) (*Response,error){
+	engine.sem <- struct{}{}
+	defer func(){ <- engine.sem}()
+
+	request, e := engine.createRequest("GET", url, headers, nil)
+	if e != nil {
+		return nil,e
+	}
+	if e := engine.breakerAllow(request.URL.Host); e != nil {
+		return nil,e
+	}
+	response, bytes, e := engine.execute(request)
+	if e != nil {
+		engine.breakerRecord(request.URL.Host,true)
+		return nil,fmt.Errorf("[GET] Url: %s Error: %v",url,e)
+	}
+	engine.breakerRecord(request.URL.Host,isHostFailure(response.StatusCode))
+	logger.InfoF("[GET] %d -> %s",response.StatusCode,url)
+	return &Response{
+		Url:        response.Request.URL.String(),
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       bytes,
+	},nil
+}
+
+//send request and read all body, hedged if enabled
+//body is closed when return
+func (engine *HttpEngine) execute(request *http.Request) (*http.Response,[]byte,error){
+	if engine.hedging != nil && request.Method == "GET" {
+		return engine.hedgedRoundTrip(request)
+	}
+	return engine.roundTrip(request)
+}
+
+//one attempt: send request and read all body
+func (engine *HttpEngine) roundTrip(request *http.Request) (*http.Response,[]byte,error){
+	start := time.Now()
+	response, e := engine.client.Do(request)
+	if e != nil {
+		return nil,nil,e
+	}
+	defer func() {
 		e := response.Body.Close()
 		if e != nil {
-			logger.WarnF("[GET] Http Get Response Close Error: %v",e)
+			logger.WarnF("[%s] Http Response Close Error: %v",request.Method,e)
 		}
-		time.Sleep(util.GetTimeSecond(1))
-		goto RETRY_LOOP
+	}()
+	bytes, e := ioutil.ReadAll(response.Body)
+	if e != nil {
+		return nil,nil,fmt.Errorf("read all data, status: %d Error: %v",response.StatusCode,e)
+	}
+	if engine.hedging != nil {
+		engine.hedging.latency.add(time.Since(start))
 	}
+	return response,bytes,nil
 }
 
 const defaultDownloadBufferSize int = 8196
@@ -223,34 +409,43 @@ func (engine *HttpEngine) Download(info *DownloadInfo) *DownloadResult {
 	engine.sem <- struct{}{} //get sem if full , that will block
 	defer func(){ <- engine.sem}() // function end, sem is returned
 
-	request, e := http.NewRequest("GET", info.Url, nil)
+	retryCount := 0
+	refreshed := false //credentials only refresh once
+RETRY_LOOP:
+	request, e := engine.createRequest("GET", info.Url, info.HttpHeaders, nil)
 	if e != nil {
 		result.E = e
 		return result
 	}
-	//need add header
-	if info.HttpHeaders != nil && len(info.HttpHeaders) > 0 {
-		for k,v := range info.HttpHeaders {
-			logger.DebugF("[Download] Url: %s Add Header: [%s : %s]",info.Url,k,v)
-			request.Header.Set(k,v)
-		}
+	if e := engine.breakerAllow(request.URL.Host); e != nil {
+		result.E = e
+		return result
 	}
-
-	retryCount := 0
-RETRY_LOOP:
 	response, e := engine.client.Do(request)
 	if e != nil {
+		engine.breakerRecord(request.URL.Host,true)
 		logger.WarnF("[Download] Retries: %d -> Url: \"%s\" Error: %v",retryCount,info.Url,e)
 		retryCount += 1
 		if retryCount >= engine.retries{
-			e = fmt.Errorf("[Download] Retry \""+strconv.Itoa(engine.retries)+
-				"\" but still can't Download Url: "+info.Url +" status: "+strconv.Itoa(response.StatusCode))
+			e = fmt.Errorf("[Download] Retry \"%d\" but still can't Download Url: %s Error: %v",engine.retries,info.Url,e)
 			result.E = e
 			return result
 		}
 		time.Sleep(util.GetTimeSecond(2))
 		goto RETRY_LOOP
 	}
+	if response.StatusCode != 200 {
+		engine.breakerRecord(request.URL.Host, isHostFailure(response.StatusCode))
+	}
+	if response.StatusCode == http.StatusUnauthorized && !refreshed && engine.refreshAuth(request) {
+		logger.InfoF("[Download] 401 -> %s credentials refreshed. Retry", info.Url)
+		refreshed = true
+		e := response.Body.Close()
+		if e != nil {
+			logger.WarnF("[Download] Http Get Response Close Error: %v", e)
+		}
+		goto RETRY_LOOP
+	}
 	if response.StatusCode == 200 {
 		buffer := make([]byte, defaultDownloadBufferSize)
 		for {
@@ -259,6 +454,7 @@ RETRY_LOOP:
 				if e == io.EOF { //read over
 					break
 				}
+				engine.breakerRecord(request.URL.Host, true)
 				logger.WarnF("[Download] Retries: %d -> Url: \"%s\" Read %d bytes Error: %v", retryCount, info.Url, result.FileSize, e)
 				retryCount += 1
 				if retryCount >= engine.retries {
@@ -279,12 +475,14 @@ RETRY_LOOP:
 			}
 			wn, e := file.Write(buffer[:n])
 			if e != nil { //write error.just return. no retry
+				engine.breakerRecord(request.URL.Host, false)
 				result.E = e
 				return result
 			}
 			logger.TraceF("[Download] Url:%s -> read %d bytes. Write %d bytes", info.Url, n,wn)
 			result.FileSize += int64(wn)
 		}
+		engine.breakerRecord(request.URL.Host, false)
 		logger.InfoF("[Download] 200 -> %s FileSize: %s", info.Url, util.GetFormatFileSize(result.FileSize))
 		defer func() {
 			e := response.Body.Close()
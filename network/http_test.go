@@ -2,9 +2,13 @@ package network
 
 import (
 	"cake/util"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestHttpEngine_Get(t *testing.T) {
@@ -23,6 +27,119 @@ func TestHttpEngine_Get_Retry(t *testing.T) {
 	}
 }
 
+func TestHttpEngine_GetOnce(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	httpEngine := CreateEngine()
+	response, e := httpEngine.GetOnce(server.URL+"/old",nil)
+	if e != nil {
+		t.Fatalf("%v",e)
+	}
+	if response.StatusCode != http.StatusNotFound || requests != 2 {
+		t.Errorf("expected 404 without retry, got %d after %d requests",response.StatusCode,requests)
+	}
+	if response.Url != server.URL+"/new" {
+		t.Errorf("expected final url, got %s",response.Url)
+	}
+}
+
+//a program wrapped DefaultTransport, like instrumentation does
+type wrappedTransport struct {
+	http.RoundTripper
+}
+
+func TestHttpEngine_WrappedDefaultTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = &wrappedTransport{defaultTransport}
+	defer func() { http.DefaultTransport = defaultTransport }()
+	httpEngine := CreateEngine()
+	if _, e := httpEngine.GetOnce(server.URL,nil); e != nil {
+		t.Errorf("%v",e)
+	}
+}
+
+func TestHttpEngine_Do(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		cookie, _ := r.Cookie("session")
+		if r.Method != http.MethodPost || string(body) != "page=2" || r.Header.Get("X-Page") != "2" || cookie == nil || cookie.Value != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("bad"))
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	httpEngine := CreateEngineByParams(MaxConnections,Timeout,2)
+	httpEngine.SetDefaultHeaders(map[string]string{"Cookie": "session=old"})
+	request := &Request{
+		Method:  http.MethodPost,
+		Url:     server.URL+"/list",
+		Headers: map[string]string{"X-Page": "2"},
+		Body:    []byte("page=2"),
+		Cookies: map[string]string{"session": "abc"},
+	}
+	response, e := httpEngine.Do(request)
+	if e != nil {
+		t.Fatalf("%v",e)
+	}
+	if string(response.Body) != "ok" || requests != 1 {
+		t.Errorf("wrong response: %s after %d requests",response.Body,requests)
+	}
+	//last response comes with status error
+	_, e = httpEngine.Do(&Request{Method: http.MethodPost,Url: server.URL+"/list"})
+	statusError, ok := e.(*StatusError)
+	if !ok || statusError.Response == nil || statusError.Response.StatusCode != http.StatusBadRequest || string(statusError.Response.Body) != "bad" {
+		t.Errorf("status error should have last response: %v",e)
+	}
+	_, e = httpEngine.Do(&Request{Url: server.URL+"/slow",Timeout: 50 * time.Millisecond})
+	if e == nil {
+		t.Errorf("request should time out")
+	}
+}
+
+func TestHttpEngine_DoRetryBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	httpEngine := CreateEngineByParams(MaxConnections,Timeout,2)
+	//POST is sent once
+	_, e := httpEngine.Do(&Request{Method: http.MethodPost,Url: server.URL,Body: []byte("form=1")})
+	if e == nil || len(bodies) != 1 {
+		t.Errorf("POST should not be retried: %v %v",e,bodies)
+	}
+	//idempotent POST is sent again with the same body
+	bodies = nil
+	if _, e := httpEngine.Do(&Request{Method: "post",Url: server.URL,Body: []byte("form=2"),Idempotent: true}); e != nil {
+		t.Fatalf("%v",e)
+	}
+	if len(bodies) != 2 || bodies[0] != "form=2" || bodies[1] != "form=2" {
+		t.Errorf("body should be sent again on retry: %q",bodies)
+	}
+}
+
 func TestHttpEngine_Download(t *testing.T) {
 	httpEngine := CreateEngine()
 	info := &DownloadInfo{
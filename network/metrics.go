@@ -0,0 +1,32 @@
+package network
+
+import "sync/atomic"
+
+//EngineMetrics is a snapshot of engine runtime statistics
+type EngineMetrics struct {
+	BreakerStates   map[string]string //host -> closed/open/half-open
+	BreakerOpened   int64             //times breakers opened
+	BreakerRejected int64             //requests failed fast by open breakers
+	HedgesFired     int64             //hedge attempts sent for slow GET
+	HedgesWon       int64             //hedge attempts which finished first
+	DNSCacheHits    int64             //hosts resolved from dns cache
+	DNSCacheMisses  int64             //hosts resolved by system resolver and cached
+}
+
+//take a snapshot of engine statistics. thread safe
+func (engine *HttpEngine) Metrics() *EngineMetrics {
+	metrics := &EngineMetrics{
+		DNSCacheHits:   atomic.LoadInt64(&engine.resolver.hits),
+		DNSCacheMisses: atomic.LoadInt64(&engine.resolver.misses),
+	}
+	if engine.breakers != nil {
+		metrics.BreakerStates = engine.breakers.states()
+		metrics.BreakerOpened = atomic.LoadInt64(&engine.breakers.opened)
+		metrics.BreakerRejected = atomic.LoadInt64(&engine.breakers.rejected)
+	}
+	if engine.hedging != nil {
+		metrics.HedgesFired = atomic.LoadInt64(&engine.hedging.fired)
+		metrics.HedgesWon = atomic.LoadInt64(&engine.hedging.won)
+	}
+	return metrics
+}